@@ -0,0 +1,181 @@
+package goldfish_re
+
+import (
+	"fmt"
+	"time"
+)
+
+// tAction declarative rule action type
+type tAction string
+
+const (
+	actionSet       tAction = "set"
+	actionIncrement tAction = "increment"
+	actionAppend    tAction = "append"
+)
+
+// actionTypes available action types keyed by its name
+var actionTypes = map[string]tAction{
+	string(actionSet):       actionSet,
+	string(actionIncrement): actionIncrement,
+	string(actionAppend):    actionAppend,
+}
+
+// _action declarative rule action applied over a context fact via a feedback transaction
+type _action struct {
+	action tAction
+	fact   string // fact token as Object.attribute
+	value  interface{}
+}
+
+// newAction action constructor normalizing the given value to a fact value
+func newAction(action tAction, fact string, value interface{}) _action {
+	if v, ok := factValue(value); ok {
+		value = v
+	}
+	return _action{action: action, fact: fact, value: value}
+}
+
+// String human-readable action
+func (a _action) String() string {
+	return fmt.Sprintf("%s %s %v", a.action, a.fact, a.value)
+}
+
+// validate checks the action fact token and that its value fits the action type
+func (a _action) validate() error {
+	if _, _, ok := splitToken(a.fact); !ok {
+		return ErrMalformedFact
+	}
+
+	switch a.action {
+	case actionSet:
+		if _, ok := factValue(a.value); !ok {
+			return fmt.Errorf("%w: %s", ErrInvalidValueType, a)
+		}
+	case actionIncrement:
+		switch a.value.(type) {
+		case int64, float64:
+		default:
+			return fmt.Errorf("%w: %s", ErrInvalidValueType, a)
+		}
+	case actionAppend:
+		if _, ok := a.value.(string); !ok {
+			return fmt.Errorf("%w: %s", ErrInvalidValueType, a)
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidAction, a.action)
+	}
+	return nil
+}
+
+// check validates the action against the data type of the target fact
+func (a _action) check(kind tTerm) error {
+	switch {
+	case a.action == actionIncrement && kind != termNumber && kind != termFloat,
+		a.action == actionAppend && kind != termString:
+		return fmt.Errorf("%w: %s cannot be applied over %s facts", ErrInvalidAction, a.action, kind)
+	}
+
+	if _, ok := actionValue(kind, a.value); !ok {
+		return fmt.Errorf("%w: %s expects a %s value", ErrInvalidValueType, a, kind)
+	}
+	return nil
+}
+
+// apply presets the action result into the given transaction.
+// Increments and appends are computed from the value seen by the transaction, so they are accumulated.
+func (a _action) apply(tx *Tx, ctx *factContext) {
+	attr, ok := ctx.Get(a.fact)
+	if !ok {
+		tx.err, tx.errFact = ErrFactNotFound, a.fact
+		return
+	}
+
+	kind := factKind(attr)
+	if err := a.check(kind); err != nil {
+		tx.fail(attr, err)
+		return
+	}
+
+	value, _ := actionValue(kind, a.value)
+	switch a.action {
+	case actionIncrement:
+		if kind == termNumber {
+			tx.IncrementNumber(attr.(Number), value.(int64))
+		} else {
+			tx.IncrementFloat(attr.(Float), value.(float64))
+		}
+	case actionAppend:
+		tx.AppendString(attr.(String), value.(string))
+	default:
+		tx.preset(attr, value)
+	}
+}
+
+// actionValue converts the given action value to the given fact data type
+func actionValue(kind tTerm, v interface{}) (interface{}, bool) {
+	switch kind {
+	case termString:
+		s, ok := v.(string)
+		return s, ok
+	case termNumber:
+		n, ok := v.(int64)
+		return n, ok
+	case termFloat:
+		switch n := v.(type) {
+		case float64:
+			return n, true
+		case int64:
+			return float64(n), true
+		}
+	case termBoolean:
+		b, ok := v.(bool)
+		return b, ok
+	case termDate:
+		switch d := v.(type) {
+		case time.Time:
+			return d, true
+		case string:
+			if date, err := parseDate(d); err == nil {
+				return date, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// factKind returns the data type of a registered fact
+func factKind(attr interface{}) tTerm {
+	switch attr.(type) {
+	case String:
+		return termString
+	case Number:
+		return termNumber
+	case Float:
+		return termFloat
+	case Boolean:
+		return termBoolean
+	case Date:
+		return termDate
+	default:
+		return termInvalid
+	}
+}
+
+// factKindValue returns the current value of a registered fact
+func factKindValue(attr interface{}) interface{} {
+	switch f := attr.(type) {
+	case String:
+		return f.Value()
+	case Number:
+		return f.Value()
+	case Float:
+		return f.Value()
+	case Boolean:
+		return f.Value()
+	case Date:
+		return f.Value()
+	default:
+		return nil
+	}
+}
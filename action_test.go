@@ -0,0 +1,49 @@
+package goldfish_re
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_action_apply(t *testing.T) {
+	rs := Builder().Ruleset().
+		OnActivation(func(then string, ctx Context) {
+			if then == "GOLD" {
+				ctx.Feedback(func(tx *Tx) {
+					miles, _ := ctx.GetNumber("User.miles")
+					tx.SetNumber(miles, 500)
+				})
+			}
+		}).
+		OnError(func(error) {}).
+		Build()
+
+	plan, status, log := NewString("User", "plan", "silver"), NewString("User", "status", "active"), NewString("User", "log", "")
+	points, miles := NewNumber("User", "points", 5), NewNumber("User", "miles", 0)
+	ctx := newTestContext(t, rs, `
+		rule "gold" when all { User.plan == "gold" } then "GOLD" { set User.status "VIP"; increment User.points 10; append User.log "gold," }
+		rule "vip" when all { User.status == "VIP" } then "VIP"
+	`, plan, status, log, points, miles)
+
+	activations, err := ctx.UpdateWithActivations(func(tx *Tx) { tx.SetString(plan, "gold") })
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"GOLD", "VIP"}, activationThens(activations))
+	assert.EqualValues(t, "VIP", status.Value())
+	assert.EqualValues(t, 15, points.Value())
+	assert.EqualValues(t, "gold,", log.Value())
+	assert.EqualValues(t, 500, miles.Value())
+}
+
+func Test_action_check(t *testing.T) {
+	_, err := Builder().Rule().AllOf(Builder().StringCondition().Term("User", "plan").Equal("gold").Build()).
+		Then("X").Increment("User.points", "ten").Build()
+	assert.ErrorIs(t, err, ErrInvalidValueType)
+
+	schema := Builder().Schema().String("User", "plan").Build()
+	strict := Builder().Ruleset().Schema(schema).OnActivation(func(string, Context) {}).OnError(func(error) {}).Build()
+	r, err := Builder().Rule().AllOf(Builder().StringCondition().Term("User", "plan").Equal("gold").Build()).
+		Then("X").Increment("User.plan", 1).Build()
+	assert.Nil(t, err)
+	assert.ErrorIs(t, strict.AddRule(r), ErrInvalidAction)
+}
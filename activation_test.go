@@ -0,0 +1,90 @@
+package goldfish_re
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// activationThens returns the then value of each activation
+func activationThens(activations []Activation) []string {
+	thens := make([]string, len(activations))
+	for i, a := range activations {
+		thens[i] = a.Then
+	}
+	return thens
+}
+
+func Test_activation_updateWithActivations(t *testing.T) {
+	rs := Builder().Ruleset().
+		OnActivation(func(then string, ctx Context) {
+			if then == "GOLD" {
+				ctx.Feedback(func(tx *Tx) {
+					status, _ := ctx.GetString("User.status")
+					tx.SetString(status, "VIP")
+				})
+			}
+		}).
+		OnError(func(error) {}).
+		Build()
+
+	plan, status, miles := NewString("User", "plan", "silver"), NewString("User", "status", "active"), NewNumber("User", "miles", 0)
+	ctx := newTestContext(t, rs, `
+		rule "gold" when any { User.plan == "gold"; User.miles > 3000 } then "GOLD"
+		rule "vip" when all { User.status == "VIP" } then "VIP"
+	`, plan, status, miles)
+
+	activations, err := ctx.UpdateWithActivations(func(tx *Tx) {
+		tx.SetString(plan, "gold")
+		tx.SetNumber(miles, 1000)
+	})
+	assert.Nil(t, err)
+	assert.Len(t, activations, 2)
+
+	assert.EqualValues(t, "gold", activations[0].Rule)
+	assert.EqualValues(t, []string{"User.plan_==_gold"}, activations[0].Conditions)
+	assert.EqualValues(t, map[string]interface{}{"User.plan": "gold", "User.miles": int64(1000)}, activations[0].Facts)
+	assert.EqualValues(t, 0, activations[0].Iteration)
+
+	assert.EqualValues(t, "vip", activations[1].Rule)
+	assert.EqualValues(t, map[string]interface{}{"User.status": "VIP"}, activations[1].Facts)
+	assert.EqualValues(t, 1, activations[1].Iteration)
+}
+
+type testDiscount struct {
+	Percent int
+}
+
+func Test_activation_outcome(t *testing.T) {
+	outcomes := make([]interface{}, 0)
+	rs := Builder().Ruleset().
+		OnActivation(func(then string, ctx Context) {
+			outcomes = append(outcomes, ctx.Activation().Outcome)
+		}).
+		OnError(func(error) {}).
+		Build()
+
+	c1 := Builder().StringCondition().Term("User", "plan").Equal("gold").Build()
+	r1, _ := Builder().Rule().Id("gold").AllOf(c1).Then("DISCOUNT").Outcome(testDiscount{Percent: 15}).Build()
+	c2 := Builder().NumberCondition().Term("User", "miles").GreaterThan(3000).Build()
+	r2, _ := Builder().Rule().Id("miles").AllOf(c2).Then("MILES").Build()
+	assert.Nil(t, rs.AddRule(r1))
+	assert.Nil(t, rs.AddRule(r2))
+
+	activations, err := rs.Evaluate(map[string]interface{}{"User.plan": "gold", "User.miles": 4000})
+	assert.Nil(t, err)
+	discount, ok := OutcomeOf[testDiscount](activations[0])
+	assert.True(t, ok)
+	assert.EqualValues(t, 15, discount.Percent)
+	_, ok = OutcomeOf[testDiscount](activations[1])
+	assert.False(t, ok)
+
+	plan, miles := NewString("User", "plan", "silver"), NewNumber("User", "miles", 0)
+	ctx := newTestContext(t, rs, emptyStr, plan, miles)
+	assert.Nil(t, ctx.Update(func(tx *Tx) {
+		tx.SetString(plan, "gold")
+		tx.SetNumber(miles, 4000)
+	}))
+	assert.EqualValues(t, []interface{}{testDiscount{Percent: 15}, nil}, outcomes)
+	assert.EqualValues(t, Activation{}, ctx.Activation())
+}
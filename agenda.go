@@ -0,0 +1,51 @@
+package goldfish_re
+
+import "sort"
+
+// tStrategy conflict resolution strategy used to order activations with the same salience
+type tStrategy uint8
+
+const (
+	// DefinitionOrderStrategy rules added first are dispatched first
+	DefinitionOrderStrategy tStrategy = iota
+	// RecencyStrategy rules triggered by the most recently updated facts are dispatched first
+	RecencyStrategy
+	// SpecificityStrategy rules with more conditions are dispatched first
+	SpecificityStrategy
+)
+
+// agenda returns the activated rules ordered by salience and then by the given strategy.
+// Ties keep the definition order. The recency function is only called by the RecencyStrategy.
+func agenda(activated []*_rule, strategy tStrategy, recency func(r *_rule) uint64) []*_rule {
+	rules := make([]*_rule, 0, len(activated))
+	for _, r := range activated {
+		if r != nil {
+			rules = append(rules, r)
+		}
+	}
+
+	recencies := map[ruid]uint64{}
+	if strategy == RecencyStrategy && recency != nil {
+		for _, r := range rules {
+			recencies[r.id] = recency(r)
+		}
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		a, b := rules[i], rules[j]
+		if a.salience != b.salience {
+			return a.salience > b.salience
+		}
+
+		switch strategy {
+		case RecencyStrategy:
+			return recencies[a.id] > recencies[b.id]
+		case SpecificityStrategy:
+			return len(a.conditions) > len(b.conditions)
+		default:
+			return false
+		}
+	})
+
+	return rules
+}
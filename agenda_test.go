@@ -0,0 +1,63 @@
+package goldfish_re
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_agenda(t *testing.T) {
+	r1 := newRule(1, opAnd, "R1")
+	r2 := newRule(2, opAnd, "R2")
+	r2.conditions[1], r2.conditions[2] = &_condition{}, &_condition{}
+	r3 := newRule(3, opAnd, "R3")
+	r4 := newRule(4, opAnd, "R4")
+	r4.salience = 10
+
+	thens := func(rules []*_rule) []string {
+		out := make([]string, len(rules))
+		for i, r := range rules {
+			out[i] = r.then
+		}
+		return out
+	}
+
+	activated := []*_rule{nil, r1, r2, r3, r4}
+	recency := func(r *_rule) uint64 { return map[ruid]uint64{1: 5, 2: 1, 3: 9, 4: 0}[r.id] }
+
+	assert.EqualValues(t, []string{"R4", "R1", "R2", "R3"}, thens(agenda(activated, DefinitionOrderStrategy, recency)))
+	assert.EqualValues(t, []string{"R4", "R3", "R1", "R2"}, thens(agenda(activated, RecencyStrategy, recency)))
+	assert.EqualValues(t, []string{"R4", "R2", "R1", "R3"}, thens(agenda(activated, SpecificityStrategy, recency)))
+}
+
+func Test_agenda_salienceAndHalt(t *testing.T) {
+	dispatched := make([]string, 0)
+	rs := Builder().Ruleset().
+		Strategy(RecencyStrategy).
+		OnActivation(func(then string, ctx Context) {
+			dispatched = append(dispatched, then)
+			if then == "BLOCK_ACCOUNT" {
+				ctx.Halt()
+			}
+		}).
+		OnError(func(error) {}).
+		Build()
+
+	miles, status, fraud := NewNumber("User", "miles", 4000), NewString("User", "status", "silver"), NewBoolean("User", "fraud", false)
+	ctx := newTestContext(t, rs, `
+		rule "bonus" when all { User.miles > 3000 } then "GRANT_BONUS"
+		rule "status" when all { User.status == "VIP" } then "VIP"
+		rule "block" salience 100 when all { User.fraud == true } then "BLOCK_ACCOUNT"
+	`, miles, status, fraud)
+
+	// the most recently updated fact goes first
+	assert.Nil(t, ctx.SetString(status, "VIP"))
+	assert.EqualValues(t, []string{"VIP", "GRANT_BONUS"}, dispatched)
+
+	// higher salience goes first and halts the agenda
+	dispatched = dispatched[:0]
+	activations, err := ctx.UpdateWithActivations(func(tx *Tx) { tx.SetBoolean(fraud, true) })
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"BLOCK_ACCOUNT"}, dispatched)
+	assert.Len(t, activations, 1)
+}
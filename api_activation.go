@@ -0,0 +1,63 @@
+package goldfish_re
+
+import "github.com/kelindar/bitmap"
+
+// Activation describes a rule activated by an evaluation
+type Activation struct {
+	// Rule activated rule identifier
+	Rule string
+	// Name activated rule name
+	Name string
+	// Then activated rule then value
+	Then string
+	// Outcome activated rule outcome payload, nil if the rule has not outcome
+	Outcome interface{}
+	// Conditions tokens of the rule conditions that were satisfied
+	Conditions []string
+	// Matched amount of top level rule expressions that were satisfied, the count compared by AtLeast, AtMost and Exactly rules
+	Matched int
+	// Facts snapshot of the facts involved into the rule conditions at evaluation time
+	Facts map[string]interface{}
+	// Iteration evaluation round into the update, 0 is the update itself and next ones are feedback iterations
+	Iteration int
+	// Version ruleset version that produced the activation
+	Version uint64
+}
+
+// newActivation builds the activation of the given rule from the activated conditions and the evaluated facts
+func newActivation(r *_rule, activatedBm bitmap.Bitmap, ctx _factContext, version uint64, iteration int) Activation {
+	a := Activation{
+		Rule:       r.token,
+		Name:       r.name,
+		Then:       r.then,
+		Outcome:    r.outcome,
+		Conditions: make([]string, 0, len(r.conditions)),
+		Matched:    r.root().matched(activatedBm),
+		Facts:      map[string]interface{}{},
+		Iteration:  iteration,
+		Version:    version,
+	}
+
+	for _, c := range r.sortedConditions() {
+		if activatedBm.Contains(c.id) {
+			a.Conditions = append(a.Conditions, c.token())
+		}
+
+		for _, term := range []iTerm{c.lTerm, c.rTerm} {
+			if !term.isVariable() {
+				continue
+			}
+			if f, ok := ctx.get(term.token()); ok {
+				a.Facts[f.token()] = f.value()
+			}
+		}
+	}
+
+	return a
+}
+
+// OutcomeOf returns the activation outcome as T. The second value is false if the rule has not an outcome of type T.
+func OutcomeOf[T interface{}](a Activation) (T, bool) {
+	outcome, ok := a.Outcome.(T)
+	return outcome, ok
+}
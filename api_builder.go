@@ -31,3 +31,30 @@ func (b *builder_) BooleanCondition() *booleanConditionBuilder { return newBoole
 
 // DateCondition returns a new dateConditionBuilder
 func (b *builder_) DateCondition() *dateConditionBuilder { return newDateConditionBuilder() }
+
+// AllOf returns a group of expressions that is matched when all of them are true
+func (b *builder_) AllOf(expressions ...Expression) *_group { return newGroup(opAnd, expressions...) }
+
+// AnyOf returns a group of expressions that is matched when at least one of them is true
+func (b *builder_) AnyOf(expressions ...Expression) *_group { return newGroup(opOr, expressions...) }
+
+// NoneOf returns a group of expressions that is matched when none of them is true
+func (b *builder_) NoneOf(expressions ...Expression) *_group { return newGroup(opNone, expressions...) }
+
+// AtLeast returns a group of expressions that is matched when at least n of them are true
+func (b *builder_) AtLeast(n int, expressions ...Expression) *_group {
+	return newThresholdGroup(opAtLeast, n, expressions...)
+}
+
+// AtMost returns a group of expressions that is matched when at most n of them are true
+func (b *builder_) AtMost(n int, expressions ...Expression) *_group {
+	return newThresholdGroup(opAtMost, n, expressions...)
+}
+
+// Exactly returns a group of expressions that is matched when exactly n of them are true
+func (b *builder_) Exactly(n int, expressions ...Expression) *_group {
+	return newThresholdGroup(opExactly, n, expressions...)
+}
+
+// Schema returns a new schemaBuilder
+func (b *builder_) Schema() *schemaBuilder { return newSchemaBuilder() }
@@ -1,26 +1,115 @@
 package goldfish_re
 
+import "time"
+
 // ruleBuilder builder struct
 type ruleBuilder struct {
-	op         tBinaryOperator
-	conditions []*_condition
-	then       string
+	id          string
+	group       *_group
+	salience    int
+	name        string
+	description string
+	owner       string
+	tags        []string
+	disabled    bool
+	from        time.Time
+	until       time.Time
+	then        string
+	outcome     interface{}
+	actions     []_action
 }
 
 // newRuleBuilder ruleBuilder constructor
-func newRuleBuilder() *ruleBuilder { return &ruleBuilder{conditions: []*_condition{}} }
+func newRuleBuilder() *ruleBuilder { return &ruleBuilder{} }
 
-// AllOf sets the rule operation as "All given conditions must be true to activate this rule"
-func (rb *ruleBuilder) AllOf(conditions ...*_condition) *ruleBuilder {
-	rb.op = opAnd
-	rb.conditions = conditions
+// AllOf sets the rule operation as "All given conditions must be true to activate this rule".
+// Conditions can be combined with nested groups built by Builder().AllOf, AnyOf or NoneOf.
+func (rb *ruleBuilder) AllOf(expressions ...Expression) *ruleBuilder {
+	rb.group = newGroup(opAnd, expressions...)
 	return rb
 }
 
 // AnyOf sets the rule operation as "At least one given conditions must be true to activate this rule"
-func (rb *ruleBuilder) AnyOf(conditions ...*_condition) *ruleBuilder {
-	rb.op = opOr
-	rb.conditions = conditions
+func (rb *ruleBuilder) AnyOf(expressions ...Expression) *ruleBuilder {
+	rb.group = newGroup(opOr, expressions...)
+	return rb
+}
+
+// NoneOf sets the rule operation as "None of the given conditions can be true to activate this rule"
+func (rb *ruleBuilder) NoneOf(expressions ...Expression) *ruleBuilder {
+	rb.group = newGroup(opNone, expressions...)
+	return rb
+}
+
+// AtLeast sets the rule operation as "At least n of the given conditions must be true to activate this rule"
+func (rb *ruleBuilder) AtLeast(n int, expressions ...Expression) *ruleBuilder {
+	rb.group = newThresholdGroup(opAtLeast, n, expressions...)
+	return rb
+}
+
+// AtMost sets the rule operation as "At most n of the given conditions can be true to activate this rule"
+func (rb *ruleBuilder) AtMost(n int, expressions ...Expression) *ruleBuilder {
+	rb.group = newThresholdGroup(opAtMost, n, expressions...)
+	return rb
+}
+
+// Exactly sets the rule operation as "Exactly n of the given conditions must be true to activate this rule"
+func (rb *ruleBuilder) Exactly(n int, expressions ...Expression) *ruleBuilder {
+	rb.group = newThresholdGroup(opExactly, n, expressions...)
+	return rb
+}
+
+// Id sets the rule identifier. If it is not set the identifier is built from the rule operator, conditions and then value.
+func (rb *ruleBuilder) Id(id string) *ruleBuilder {
+	rb.id = id
+	return rb
+}
+
+// Salience sets the rule priority. Activations with higher salience are dispatched first, the default is zero.
+func (rb *ruleBuilder) Salience(salience int) *ruleBuilder {
+	rb.salience = salience
+	return rb
+}
+
+// Name sets the human-facing rule name reported into activations and errors
+func (rb *ruleBuilder) Name(name string) *ruleBuilder {
+	rb.name = name
+	return rb
+}
+
+// Description sets the rule description
+func (rb *ruleBuilder) Description(description string) *ruleBuilder {
+	rb.description = description
+	return rb
+}
+
+// Owner sets the team or person that owns the rule
+func (rb *ruleBuilder) Owner(owner string) *ruleBuilder {
+	rb.owner = owner
+	return rb
+}
+
+// Tags adds the given tags to the rule, they can be used to list rules via Ruleset.RulesByTag
+func (rb *ruleBuilder) Tags(tags ...string) *ruleBuilder {
+	rb.tags = append(rb.tags, tags...)
+	return rb
+}
+
+// Disabled builds the rule disabled, it can be enabled at runtime via Ruleset.EnableRule
+func (rb *ruleBuilder) Disabled() *ruleBuilder {
+	rb.disabled = true
+	return rb
+}
+
+// EffectiveFrom sets the time since the rule can be activated
+func (rb *ruleBuilder) EffectiveFrom(from time.Time) *ruleBuilder {
+	rb.from = from
+	return rb
+}
+
+// EffectiveUntil sets the time since the rule cannot be activated anymore
+func (rb *ruleBuilder) EffectiveUntil(until time.Time) *ruleBuilder {
+	rb.until = until
 	return rb
 }
 
@@ -30,22 +119,93 @@ func (rb *ruleBuilder) Then(s string) *ruleBuilder {
 	return rb
 }
 
+// Outcome sets a structured payload delivered with the rule activations, like a discount percentage.
+// It is read via Activation.Outcome or OutcomeOf, the then value is still required.
+func (rb *ruleBuilder) Outcome(outcome interface{}) *ruleBuilder {
+	rb.outcome = outcome
+	return rb
+}
+
+// Set adds an action that sets the given fact (Object.attribute) with the given value when the rule is activated.
+// Actions are applied by a feedback update after the activation handler, so they can activate other rules.
+func (rb *ruleBuilder) Set(fact string, value interface{}) *ruleBuilder {
+	rb.actions = append(rb.actions, newAction(actionSet, fact, value))
+	return rb
+}
+
+// Increment adds an action that increments the given Number or Float fact by the given value when the rule is activated
+func (rb *ruleBuilder) Increment(fact string, by interface{}) *ruleBuilder {
+	rb.actions = append(rb.actions, newAction(actionIncrement, fact, by))
+	return rb
+}
+
+// Append adds an action that appends the given text to the given String fact when the rule is activated
+func (rb *ruleBuilder) Append(fact string, value string) *ruleBuilder {
+	rb.actions = append(rb.actions, newAction(actionAppend, fact, value))
+	return rb
+}
+
 // Build rule builder method
 func (rb *ruleBuilder) Build() (*_rule, error) {
 	if rb.then == emptyStr {
 		return nil, ErrEmptyThenSentence
 	}
 
-	if len(rb.conditions) == 0 {
+	if rb.group == nil {
 		return nil, ErrEmptyConditionList
 	}
 
-	r := newRule(0, rb.op, rb.then)
-	for i, c := range rb.conditions {
-		c.id = cuid(i)
-		if err := r.addCondition(c); err != nil {
+	if err := rb.group.validate(); err != nil {
+		return nil, err
+	}
+
+	if !rb.from.IsZero() && !rb.until.IsZero() && !rb.from.Before(rb.until) {
+		return nil, ErrInvalidEffectiveWindow
+	}
+
+	for _, a := range rb.actions {
+		if err := a.validate(); err != nil {
 			return nil, err
 		}
 	}
+
+	r := newRule(0, rb.group.operator, rb.then)
+	r.salience = rb.salience
+	r.name = rb.name
+	r.description = rb.description
+	r.owner = rb.owner
+	r.tags = append([]string{}, rb.tags...)
+	r.disabled = rb.disabled
+	r.effectiveFrom = rb.from
+	r.effectiveUntil = rb.until
+	r.outcome = rb.outcome
+	r.actions = append([]_action{}, rb.actions...)
+	if !rb.group.nested() {
+		for i, c := range rb.group.conditions {
+			c.id = cuid(i)
+			if err := r.addCondition(c); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		// conditions repeated into several groups are evaluated once
+		byToken := map[string]*_condition{}
+		for _, c := range rb.group.leaves() {
+			if _, exists := byToken[c.token()]; exists {
+				continue
+			}
+			c.id = cuid(len(byToken))
+			byToken[c.token()] = c
+			if err := r.addCondition(c); err != nil {
+				return nil, err
+			}
+		}
+		r.group = rb.group.compile(func(c *_condition) *_condition { return byToken[c.token()] })
+	}
+
+	r.token = rb.id
+	if r.token == emptyStr {
+		r.token = ruleToken(rb.group.tokens(), rb.group.operatorToken(), rb.then)
+	}
 	return r, nil
 }
@@ -1,9 +1,62 @@
 package goldfish_re
 
+import "time"
+
 // rulesetBuilder ruleset build object
 type rulesetBuilder struct {
-	successFn func(string, Context)
-	errorFn   func(error)
+	name        string
+	description string
+	schema      _schema
+	strategy    tStrategy
+	hitPolicy   tHitPolicy
+	clock       func() time.Time
+	lifecycleFn func(RuleLifecycle)
+	successFn   func(string, Context)
+	errorFn     func(error)
+}
+
+// Name sets the ruleset name
+func (rb *rulesetBuilder) Name(name string) *rulesetBuilder {
+	rb.name = name
+	return rb
+}
+
+// Description sets the ruleset description
+func (rb *rulesetBuilder) Description(description string) *rulesetBuilder {
+	rb.description = description
+	return rb
+}
+
+// Schema sets the fact schema used to type check the ruleset conditions and the context facts
+func (rb *rulesetBuilder) Schema(schema _schema) *rulesetBuilder {
+	rb.schema = schema
+	return rb
+}
+
+// Strategy sets how the agenda orders the activations with the same salience.
+// DefinitionOrderStrategy is used by default.
+func (rb *rulesetBuilder) Strategy(strategy tStrategy) *rulesetBuilder {
+	rb.strategy = strategy
+	return rb
+}
+
+// HitPolicy sets which of the matched rules are dispatched on each evaluation. CollectPolicy is used by default.
+func (rb *rulesetBuilder) HitPolicy(policy tHitPolicy) *rulesetBuilder {
+	rb.hitPolicy = policy
+	return rb
+}
+
+// Clock sets the function used to get the current time to check the rules effective windows, time.Now by default
+func (rb *rulesetBuilder) Clock(clock func() time.Time) *rulesetBuilder {
+	rb.clock = clock
+	return rb
+}
+
+// OnLifecycle sets the optional handler to call when a rule becomes effective or expires.
+// One-shot evaluations call it out of the ruleset lock, so it can be called concurrently.
+func (rb *rulesetBuilder) OnLifecycle(fn func(RuleLifecycle)) *rulesetBuilder {
+	rb.lifecycleFn = fn
+	return rb
 }
 
 // OnActivation sets the user function to call when a rule is activated
@@ -12,7 +65,8 @@ func (rb *rulesetBuilder) OnActivation(fn func(string, Context)) *rulesetBuilder
 	return rb
 }
 
-// OnError sets the user error handler to call when a ruleset evaluation runs an error
+// OnError sets the user error handler to call when a ruleset evaluation runs an error.
+// It is called out of the ruleset lock, so it can use the ruleset, and it can be called concurrently by different contexts.
 func (rb *rulesetBuilder) OnError(fn func(err error)) *rulesetBuilder {
 	rb.errorFn = fn
 	return rb
@@ -24,7 +78,13 @@ func (rb *rulesetBuilder) Build() *ruleset {
 	if rb.successFn == nil || rb.errorFn == nil {
 		panic("Success function and Error function must be provided")
 	}
-	return &ruleset{rs: newRuleset(), successFn: rb.successFn, errorFn: rb.errorFn}
+	rs := newRuleset()
+	rs.name = rb.name
+	rs.description = rb.description
+	rs.schema = rb.schema
+	rs.clock = rb.clock
+	return newRulesetWrapper(rulesetVersion{rs: rs, strategy: rb.strategy, hitPolicy: rb.hitPolicy, lifecycleFn: rb.lifecycleFn},
+		rb.successFn, rb.errorFn)
 }
 
 // newRulesetBuilder rulesetBuilder constructor function
@@ -0,0 +1,51 @@
+package goldfish_re
+
+// schemaBuilder fact schema builder
+type schemaBuilder struct {
+	schema _schema
+}
+
+// newSchemaBuilder schemaBuilder constructor function
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{schema: _schema{}}
+}
+
+// fact declares the data type of the given fact
+func (sb *schemaBuilder) fact(object, attribute string, kind tTerm) *schemaBuilder {
+	sb.schema[newVarTerm(object, attribute, kind).token()] = kind
+	return sb
+}
+
+// String declares the given fact as String
+func (sb *schemaBuilder) String(object, attribute string) *schemaBuilder {
+	return sb.fact(object, attribute, termString)
+}
+
+// Number declares the given fact as Number
+func (sb *schemaBuilder) Number(object, attribute string) *schemaBuilder {
+	return sb.fact(object, attribute, termNumber)
+}
+
+// Float declares the given fact as Float
+func (sb *schemaBuilder) Float(object, attribute string) *schemaBuilder {
+	return sb.fact(object, attribute, termFloat)
+}
+
+// Boolean declares the given fact as Boolean
+func (sb *schemaBuilder) Boolean(object, attribute string) *schemaBuilder {
+	return sb.fact(object, attribute, termBoolean)
+}
+
+// Date declares the given fact as Date
+func (sb *schemaBuilder) Date(object, attribute string) *schemaBuilder {
+	return sb.fact(object, attribute, termDate)
+}
+
+// Build _schema build method
+func (sb *schemaBuilder) Build() _schema {
+	schema := make(_schema, len(sb.schema))
+	for token, kind := range sb.schema {
+		schema[token] = kind
+	}
+	return schema
+}
@@ -1,10 +1,11 @@
 package goldfish_re
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,11 +28,17 @@ type Context interface {
 	GetObject(object string) (interface{}, bool)
 	ForEach(fn func(fact string, value interface{}))
 	Feedback(func(tx *Tx))
+	Version() uint64
+	Halt()
+	Activation() Activation
+	Context() context.Context
 }
 
 // FactsContext interface that is returned when a Context is created from a ruleset
 type FactsContext interface {
 	WithMaxIterations(i int)
+	WithFeedbackMode(mode tFeedbackMode)
+	WithReentrancy(mode tReentrancy)
 	Register(object interface{}) error
 	RegisterString(object interface{}, attribute String) error
 	RegisterNumber(object interface{}, attribute Number) error
@@ -44,33 +51,177 @@ type FactsContext interface {
 	SetBoolean(attribute interface{}, value bool) error
 	SetDate(attribute interface{}, value time.Time) error
 	Update(fn func(tx *Tx)) error
+	UpdateWithActivations(fn func(tx *Tx)) ([]Activation, error)
+	UpdateContext(c context.Context, fn func(tx *Tx)) error
+	UpdateAsync(fn func(tx *Tx)) *Future
+	WithCoalescing(window time.Duration, maxUpdates int) error
+	Flush() error
+	WithRollback(enabled bool)
+	Explain(rule string) (*Explanation, error)
 }
 
 // factContext internal context
 type factContext struct {
-	mt                sync.Mutex
+	mt                chan struct{} // context lock acquired by the updates, a channel so waiting can be cancelled
 	registeredFacts   map[string]interface{}
 	registeredObjects map[string]interface{}
 	iFactRef          _factContext
 	rs                *ruleset
+	version           *rulesetVersion
 
-	feedback      bool
-	feedbackFn    func(tx *Tx)
+	feedbacks     []_feedback // feedback transactions queued in activation order
+	feedbackMode  tFeedbackMode
 	maxIterations int
+	history       factHistory // values committed by the running update
+
+	handler    uint64 // goroutine running the activation handler, 0 out of it
+	reentrancy tReentrancy
+
+	rollback   bool
+	async      asyncQueue
+	coalescing atomic.Value // *coalescer, nil when updates are not coalesced
+
+	halted     bool
+	goCtx      context.Context // context.Context of the running update
+	recovered  error           // first activation handler panic of the running update, returned by it
+	activation *Activation     // activation being dispatched
+	seq        uint64
+	recency    map[string]uint64 // update sequence of each fact
 }
 
 // newContext internal context constructor
 func newContext(rs *ruleset) *factContext {
 	return &factContext{registeredFacts: map[string]interface{}{}, registeredObjects: map[string]interface{}{},
-		iFactRef: _factContext{}, rs: rs, maxIterations: maxIterations}
+		iFactRef: _factContext{}, rs: rs, maxIterations: maxIterations, recency: map[string]uint64{}, mt: make(chan struct{}, 1)}
 }
 
 func (ctx *factContext) WithMaxIterations(i int) {
 	ctx.maxIterations = i
 }
 
-// register internal method to register a fact and its parent object into the context
-func (ctx *factContext) register(key string, obj interface{}, attr interface{}, ref iFact) {
+// WithFeedbackMode sets how the feedback transactions queued by the same evaluation are applied,
+// MergeFeedback (default) or SequentialFeedback
+func (ctx *factContext) WithFeedbackMode(mode tFeedbackMode) {
+	ctx.feedbackMode = mode
+}
+
+// WithReentrancy sets how the updates called from the activation handler of this context are handled,
+// DeferReentrant (default) or RejectReentrant
+func (ctx *factContext) WithReentrancy(mode tReentrancy) {
+	ctx.reentrancy = mode
+}
+
+// WithCoalescing enables the coalescing of the Update and Set calls: the updates arriving within the given window,
+// or up to the given amount of updates, are merged into a single transaction and evaluated once. The last value set
+// to each fact wins. A zero window or amount disables that limit, and both zero disable the coalescing.
+// Coalesced calls return before the evaluation, their update functions run when the batch is flushed, except the one
+// that reaches the max amount which flushes it and returns the combined errors of the batch as *CoalescedError. Batches flushed by the window report them to the error handler.
+// The updates pending from a previous configuration are flushed first, returning its combined errors.
+// Flushes requested from the activation handler are applied as feedback, or rejected, like the re-entrant updates.
+func (ctx *factContext) WithCoalescing(window time.Duration, maxUpdates int) error {
+	var next *coalescer
+	if window > 0 || maxUpdates > 0 {
+		next = newCoalescer(window, maxUpdates)
+	}
+	prev, _ := ctx.coalescing.Swap(next).(*coalescer)
+	return ctx.flush(prev)
+}
+
+// coalescer returns the current coalescer, nil when updates are not coalesced
+func (ctx *factContext) coalescer() *coalescer {
+	c, _ := ctx.coalescing.Load().(*coalescer)
+	return c
+}
+
+// WithRollback enables the all-or-nothing updates: if the update, any feedback iteration or an activation handler fails,
+// the facts are restored to the values that they had before the update. The failure is returned by the update.
+// Side effects of the activation handlers already dispatched are not undone.
+func (ctx *factContext) WithRollback(enabled bool) {
+	ctx.rollback = enabled
+}
+
+// restore sets back the values that the facts updated by the running update had before it
+func (ctx *factContext) restore() {
+	tx := newTx()
+	for token, values := range ctx.history {
+		if obj, ok := ctx.registeredFacts[token]; ok {
+			tx.toApply[obj] = values[0]
+		}
+	}
+
+	tx.commit()
+	ctx.touch(tx.tokens()...)
+	ctx.history = factHistory{}
+}
+
+// Flush evaluates the pending coalesced updates returning its combined errors as *CoalescedError
+func (ctx *factContext) Flush() error {
+	return ctx.flush(ctx.coalescer())
+}
+
+// flush evaluates the pending updates of the given coalescer, which may no longer be the current one
+func (ctx *factContext) flush(c *coalescer) error {
+	if c == nil {
+		return nil
+	}
+
+	// the activation handler can't wait for the flush running its own update, the batch is handled like a re-entrant update
+	if ctx.reentrant() {
+		if ctx.reentrancy == RejectReentrant {
+			return ErrReentrantUpdate
+		}
+		if pending := c.take(); len(pending) > 0 {
+			ctx.Feedback(func(tx *Tx) {
+				if err := newCoalescedError(applyBatch(pending, tx)); err != nil {
+					ctx.rs.fail(err)
+				}
+			})
+		}
+		return nil
+	}
+
+	c.flushMtx.Lock()
+	defer c.flushMtx.Unlock()
+
+	pending := c.take()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	// the update functions run under the context lock, so increments and appends are computed from the committed values
+	var errs []error
+	_, err := ctx.UpdateWithActivations(func(tx *Tx) { errs = applyBatch(pending, tx) })
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return newCoalescedError(errs)
+}
+
+// coalesce stages the update into the current coalesced batch
+func (ctx *factContext) coalesce(c *coalescer, fn func(tx *Tx)) error {
+	full, timed := c.stage(fn)
+	// a coalescer replaced while staging was already flushed by WithCoalescing, so nobody else would flush this update
+	if full || ctx.coalescer() != c {
+		return ctx.flush(c)
+	}
+
+	if timed {
+		c.schedule(func() {
+			if err := ctx.flush(c); err != nil {
+				ctx.rs.fail(err)
+			}
+		})
+	}
+	return nil
+}
+
+// register internal method to register a fact and its parent object into the context.
+// Facts that contradict the ruleset schema are rejected.
+func (ctx *factContext) register(key string, obj interface{}, attr interface{}, ref iFact) error {
+	if err := ctx.rs.current().schema.checkFact(ref); err != nil {
+		return err
+	}
+
 	objKey := objectName(key)
 	if _, ok := ctx.registeredObjects[objKey]; !ok {
 		ctx.registeredObjects[objKey] = obj
@@ -78,6 +229,29 @@ func (ctx *factContext) register(key string, obj interface{}, attr interface{},
 
 	ctx.registeredFacts[key] = attr
 	ctx.iFactRef.set(ref)
+	ctx.touch(key)
+	return nil
+}
+
+// touch marks the given facts as the most recently updated ones
+func (ctx *factContext) touch(tokens ...string) {
+	ctx.seq++
+	for _, token := range tokens {
+		ctx.recency[token] = ctx.seq
+	}
+}
+
+// recencyOf returns the update sequence of the most recently updated fact involved into the rule conditions
+func (ctx *factContext) recencyOf(r *_rule) uint64 {
+	var recency uint64
+	for _, c := range r.conditions {
+		for _, term := range []iTerm{c.lTerm, c.rTerm} {
+			if term.isVariable() && ctx.recency[term.token()] > recency {
+				recency = ctx.recency[term.token()]
+			}
+		}
+	}
+	return recency
 }
 
 // Register generic method to register an object with its facts.
@@ -133,31 +307,41 @@ func (ctx *factContext) Register(object interface{}) error {
 						elem := NewString(obj, attr, val)
 						field.Elem().Set(reflect.Indirect(reflect.ValueOf(elem)))
 						f := field.Interface().(String)
-						ctx.register(f.token(), object, f, f.fact)
+						if err := ctx.register(f.token(), object, f, f.fact); err != nil {
+							return err
+						}
 					} else if ftype == reflectiveNumberType {
 						num := parseIntOrDefault(val, 0)
 						elem := NewNumber(obj, attr, num)
 						field.Elem().Set(reflect.Indirect(reflect.ValueOf(elem)))
 						f := field.Interface().(Number)
-						ctx.register(f.token(), object, f, f.fact)
+						if err := ctx.register(f.token(), object, f, f.fact); err != nil {
+							return err
+						}
 					} else if ftype == reflectiveBooleanType {
 						b := parseBooleanOrDefault(val, false)
 						elem := NewBoolean(obj, attr, b)
 						field.Elem().Set(reflect.Indirect(reflect.ValueOf(elem)))
 						f := field.Interface().(Boolean)
-						ctx.register(f.token(), object, f, f.fact)
+						if err := ctx.register(f.token(), object, f, f.fact); err != nil {
+							return err
+						}
 					} else if ftype == reflectiveFloatType {
 						num := parseFloatOrDefault(val, 0.0)
 						elem := NewFloat(obj, attr, num)
 						field.Elem().Set(reflect.Indirect(reflect.ValueOf(elem)))
 						f := field.Interface().(Float)
-						ctx.register(f.token(), object, f, f.fact)
+						if err := ctx.register(f.token(), object, f, f.fact); err != nil {
+							return err
+						}
 					} else if ftype == reflectiveDateType {
 						date := parseDateOrDefault(val, zeroDate)
 						elem := NewDate(obj, attr, date)
 						field.Elem().Set(reflect.Indirect(reflect.ValueOf(elem)))
 						f := field.Interface().(Date)
-						ctx.register(f.token(), object, f, f.fact)
+						if err := ctx.register(f.token(), object, f, f.fact); err != nil {
+							return err
+						}
 					}
 				}
 			}
@@ -202,20 +386,18 @@ func (ctx *factContext) registerFact(object interface{}, attr interface{}) error
 
 	switch f := attr.(type) {
 	case String:
-		ctx.register(f.token(), object, f, f.fact)
+		return ctx.register(f.token(), object, f, f.fact)
 	case Number:
-		ctx.register(f.token(), object, f, f.fact)
+		return ctx.register(f.token(), object, f, f.fact)
 	case Float:
-		ctx.register(f.token(), object, f, f.fact)
+		return ctx.register(f.token(), object, f, f.fact)
 	case Date:
-		ctx.register(f.token(), object, f, f.fact)
+		return ctx.register(f.token(), object, f, f.fact)
 	case Boolean:
-		ctx.register(f.token(), object, f, f.fact)
+		return ctx.register(f.token(), object, f, f.fact)
 	default:
 		return ErrInvalidDataType
 	}
-
-	return nil
 }
 
 // RegisterString registers String facts
@@ -273,12 +455,13 @@ func (ctx *factContext) SetDate(attribute interface{}, value time.Time) error {
 	return ctx.set(attribute, value)
 }
 
-func (ctx *factContext) update(fn func(tx *Tx), skip map[string]struct{}) (toSkip map[string]struct{}, finalErr error) {
+func (ctx *factContext) update(fn func(tx *Tx), skip map[string]struct{}, iteration int) (toSkip map[string]struct{}, activations []Activation, finalErr error) {
 	toSkip = map[string]struct{}{}
 	// catch possible custom user errors into update function
 	defer func() {
 		if r := recover(); r != nil {
 			finalErr = ErrContextUpdateRecovered
+			ctx.rs.fail(&EvalError{Cause: fmt.Errorf("%w: %v", ErrContextUpdateRecovered, r)})
 		}
 	}()
 
@@ -286,51 +469,254 @@ func (ctx *factContext) update(fn func(tx *Tx), skip map[string]struct{}) (toSki
 
 	fn(tx)
 
-	if !tx.hasError() { // TODO if performance is poor... run evaluation async (use mutex to ensure the context data)
+	if !tx.hasError() {
+		ctx.history.trace(tx)
 		tx.commit()
+		ctx.touch(tx.tokens()...)
 		//ctx.rs.EvalFacts(ctx)
-		toSkip = ctx.rs.evalFactsWithSkip(ctx, skip)
+		toSkip, activations = ctx.rs.evalFactsWithSkip(ctx, skip, iteration)
 	}
 
 	if tx.err != nil {
-		return toSkip, tx.err
+		ctx.rs.fail(tx.evalError())
+		return toSkip, activations, tx.err
 	}
 
-	return toSkip, tx.userErr
+	return toSkip, activations, tx.userErr
 }
 
-// Update run a thread-safe facts/context update via a transaction
+// Update run a thread-safe facts/context update via a transaction.
+// The whole update, feedback iterations included, is evaluated against the ruleset version published when it starts.
+// If the feedback loop reaches the max iterations a *CycleError wrapping ErrMaxIterationsReached is returned.
+// Activation handler panics are sent to the error handler and returned as *EvalError wrapping ErrActivationRecovered.
+// Updates can be coalesced, see WithCoalescing.
 func (ctx *factContext) Update(fn func(tx *Tx)) (finalErr error) {
-	ctx.mt.Lock()
-	defer ctx.mt.Unlock()
+	if c := ctx.coalescer(); c != nil && !ctx.reentrant() {
+		return ctx.coalesce(c, fn)
+	}
+
+	_, finalErr = ctx.UpdateWithActivations(fn)
+	return finalErr
+}
+
+// UpdateWithActivations same as Update but also returns the activations dispatched by the update
+// and its feedback iterations, in the order that they were fired.
+// Updates called from the activation handler of this context are deferred as feedback or rejected, see WithReentrancy.
+func (ctx *factContext) UpdateWithActivations(fn func(tx *Tx)) ([]Activation, error) {
+	return ctx.updateContext(context.Background(), fn)
+}
+
+// UpdateContext same as Update but stops waiting for a concurrent update, and stops between feedback iterations and
+// between activations, when the given context.Context is done, returning its error. The context.Context is available
+// to the activation handlers. Facts committed before the cancellation are kept, unless the rollback is enabled.
+func (ctx *factContext) UpdateContext(c context.Context, fn func(tx *Tx)) error {
+	_, err := ctx.updateContext(c, fn)
+	return err
+}
+
+// UpdateAsync enqueues the update on the context worker returning without waiting for its evaluation.
+// Asynchronous updates are evaluated in submission order, the returned future yields its activations and final error.
+func (ctx *factContext) UpdateAsync(fn func(tx *Tx)) *Future {
+	u := asyncUpdate{fn: fn, future: newFuture()}
+	if ctx.async.push(u) {
+		go ctx.async.work(ctx.UpdateWithActivations)
+	}
+	return u.future
+}
+
+// updateContext runs the update and its feedback iterations while the given context.Context is not done
+func (ctx *factContext) updateContext(c context.Context, fn func(tx *Tx)) ([]Activation, error) {
+	// updates called by the goroutine that is running the evaluation, like from the activation handler,
+	// would deadlock waiting for themselves
+	if ctx.reentrant() {
+		if ctx.reentrancy == RejectReentrant {
+			return nil, ErrReentrantUpdate
+		}
+		ctx.Feedback(fn)
+		return make([]Activation, 0), nil
+	}
+
+	if err := c.Err(); err != nil {
+		return make([]Activation, 0), err
+	}
+
+	// waiting for a concurrent update stops when the context.Context is done
+	select {
+	case ctx.mt <- struct{}{}:
+	case <-c.Done():
+		return make([]Activation, 0), c.Err()
+	}
+	defer func() { <-ctx.mt }()
+	ctx.goCtx = c
+	defer func() { ctx.goCtx = nil }()
+
+	ctx.version = ctx.rs.version()
+	ctx.history = factHistory{}
+	ctx.recovered = nil
+
+	// activation handler panics are sent to the error handler and returned too
+	activations, err := ctx.evaluate(c, fn)
+	if err == nil && ctx.recovered != nil {
+		err = ctx.recovered
+	}
+	if err != nil && ctx.rollback {
+		ctx.restore()
+	}
+	return activations, err
+}
+
+// reentrant reports if it is called from the activation handler dispatched by this context
+func (ctx *factContext) reentrant() bool {
+	handler := atomic.LoadUint64(&ctx.handler)
+	return handler != 0 && handler == goroutineID()
+}
+
+// evaluate runs the update and its feedback iterations. The caller must hold the context lock
+func (ctx *factContext) evaluate(c context.Context, fn func(tx *Tx)) ([]Activation, error) {
 
 	var toSkip map[string]struct{}
-	if skp, err := ctx.update(fn, map[string]struct{}{}); err != nil {
-		return err
+	activations := make([]Activation, 0)
+	if skp, acts, err := ctx.update(fn, map[string]struct{}{}, 0); err != nil {
+		return append(activations, acts...), err
 	} else {
 		toSkip = skp
+		activations = append(activations, acts...)
 	}
 
-	for i := 0; ctx.feedback && i < ctx.maxIterations; i++ {
-		ctx.feedback = false
-		if skp, err := ctx.update(ctx.feedbackFn, toSkip); err != nil {
-			return err
-		} else {
-			toSkip = skp
+	// each iteration applies the feedback queued by the previous evaluation, merged or one by one.
+	// Sequential updates of the same batch skip the rules already fired by the batch too.
+	i := 0
+	for len(ctx.feedbacks) > 0 && i < ctx.maxIterations {
+		batch := newFeedbackBatch(ctx.feedbacks)
+		ctx.feedbacks = nil
+		skip, fired := toSkip, map[string]struct{}{}
+
+		fns := []func(tx *Tx){batch.merged(ctx.rs.fail)}
+		if ctx.feedbackMode == SequentialFeedback {
+			fns = fns[:0]
+			for _, fb := range batch.feedbacks {
+				fns = append(fns, batch.sequential(fb, ctx.rs.fail))
+			}
+		}
+
+		for j, fn := range fns {
+			if err := c.Err(); err != nil {
+				ctx.feedbacks = nil
+				return activations, err
+			}
+			if i >= ctx.maxIterations {
+				ctx.feedbacks = append(batch.feedbacks[j:], ctx.feedbacks...)
+				break
+			}
+			i++
+
+			skp, acts, err := ctx.update(fn, skip, i)
+			activations = append(activations, acts...)
+			if err != nil {
+				ctx.feedbacks = nil
+				return activations, err
+			}
+			skip, fired = union(toSkip, fired, skp), union(fired, skp)
 		}
+		toSkip = fired
 	}
 
-	return nil
+	if err := c.Err(); err != nil {
+		ctx.feedbacks = nil
+		return activations, err
+	}
+
+	if len(ctx.feedbacks) > 0 {
+		ctx.feedbacks = nil
+		err := newCycleError(i, activations, ctx.history)
+		ctx.rs.fail(&EvalError{Cause: err})
+		return activations, err
+	}
+
+	return activations, nil
 }
 
-// Feedback run a thread-safe facts/context update via a transaction
+// Feedback queues a facts/context update via a transaction, applied after the current evaluation.
+// Feedbacks queued by several activations of the same evaluation are all applied in activation order.
 func (ctx *factContext) Feedback(fn func(tx *Tx)) {
 	if fn == nil {
 		return
 	}
 
-	ctx.feedbackFn = fn
-	ctx.feedback = true
+	fb := _feedback{fn: fn}
+	if ctx.activation != nil {
+		fb.rule = ctx.activation.Rule
+	}
+	ctx.feedbacks = append(ctx.feedbacks, fb)
+}
+
+// feedbackActions queues a feedback update applying the given rule actions
+func (ctx *factContext) feedbackActions(actions []_action) {
+	if len(actions) == 0 {
+		return
+	}
+
+	ctx.Feedback(func(tx *Tx) {
+		for _, a := range actions {
+			a.apply(tx, ctx)
+		}
+	})
+}
+
+// Halt stops dispatching the rest of the activations of the current agenda.
+// It is meant to be called from the activation handler, feedback updates already requested still run.
+func (ctx *factContext) Halt() {
+	ctx.halted = true
+}
+
+// Context returns the context.Context of the running update, given by UpdateContext.
+// Updates without context.Context return context.Background().
+func (ctx *factContext) Context() context.Context {
+	if ctx.goCtx == nil {
+		return context.Background()
+	}
+	return ctx.goCtx
+}
+
+// stopped checks whether the rest of the agenda must not be dispatched, halted or canceled
+func (ctx *factContext) stopped() bool {
+	return ctx.halted || (ctx.goCtx != nil && ctx.goCtx.Err() != nil)
+}
+
+// Activation returns the activation being dispatched to the activation handler, including its rule outcome.
+// Out of the handler it returns an empty activation.
+func (ctx *factContext) Activation() Activation {
+	if ctx.activation == nil {
+		return Activation{}
+	}
+	return *ctx.activation
+}
+
+// Version returns the ruleset version evaluated by the running (or last) update.
+// Called from the activation handler it is the version that produced the activation.
+func (ctx *factContext) Version() uint64 {
+	if ctx.version == nil {
+		return ctx.rs.Version()
+	}
+	return ctx.version.version
+}
+
+// Explain reports why the rule with the given identifier is activated or not by the current context facts,
+// evaluated against the current ruleset version. It waits for the running update, unless called from its activation handler.
+func (ctx *factContext) Explain(rule string) (*Explanation, error) {
+	if !ctx.reentrant() {
+		ctx.mt <- struct{}{}
+		defer func() { <-ctx.mt }()
+	}
+
+	version := ctx.rs.version()
+	e, err := version.rs.explain(rule, ctx.snapshot())
+	if err != nil {
+		return nil, err
+	}
+
+	e.Version = version.version
+	return e, nil
 }
 
 // GetObject returns a fact's parent object
@@ -410,6 +796,15 @@ func (ctx *factContext) GetDate(fact string) (Date, error) {
 	}
 }
 
+// snapshot returns a copy of the context facts with the values read through the synchronized accessors
+func (ctx *factContext) snapshot() _factContext {
+	facts := make(_factContext, len(ctx.iFactRef))
+	for token, f := range ctx.iFactRef {
+		facts.set(newFact(f.object(), f.attribute(), factKindValue(ctx.registeredFacts[token])))
+	}
+	return facts
+}
+
 // ForEach iterates over all registered facts
 func (ctx *factContext) ForEach(fn func(fact string, value interface{})) {
 	for k, v := range ctx.iFactRef {
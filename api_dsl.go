@@ -0,0 +1,24 @@
+package goldfish_re
+
+// ParseRules parses a rule language source returning the defined rules ready to be added into a ruleset.
+//
+//	rule "frequent flyer" when all { User.plan == "gold"; User.miles > 3000 } then "ACTIVE_GOLD_AWARD"
+//
+// A *ParseError with the line and column of the offending token is returned if the source is malformed.
+func ParseRules(src string) ([]*_rule, error) {
+	return newParser(src).parseRules()
+}
+
+// ParseRule parses a rule language source that must define exactly one rule.
+func ParseRule(src string) (*_rule, error) {
+	p := newParser(src)
+	r, err := p.parseRule()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.tkn.kind != tokenEOF {
+		return nil, p.errorf(p.tkn, "expected %s but found %s", tokenEOF, p.tkn.kind)
+	}
+	return r, nil
+}
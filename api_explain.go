@@ -0,0 +1,109 @@
+package goldfish_re
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Explanation reports why a rule did or did not fire for the facts of a context
+type Explanation struct {
+	// Rule explained rule identifier
+	Rule string
+	// Name explained rule name
+	Name string
+	// Then explained rule then value
+	Then string
+	// Operator rule operator: all, any, none or a threshold like atleast 3
+	Operator string
+	// Activated whether the rule is activated by the current facts
+	Activated bool
+	// Disabled whether the rule is disabled, disabled rules are never activated
+	Disabled bool
+	// Effective whether the current time is into the rule effective window
+	Effective bool
+	// Version ruleset version used to explain the rule
+	Version uint64
+	// Conditions evaluation details of each rule condition
+	Conditions []ConditionExplanation
+	// Blocking tokens of the conditions that blocked the activation through all and none groups
+	Blocking []string
+}
+
+// ConditionExplanation reports how a condition was evaluated
+type ConditionExplanation struct {
+	// Token condition token
+	Token string
+	// Left left term, always a fact
+	Left string
+	// LeftValue compared left value
+	LeftValue interface{}
+	// LeftMissing the left fact is not present into the context
+	LeftMissing bool
+	// Operator condition operator
+	Operator string
+	// Right right term, a fact or a discrete value
+	Right string
+	// RightFact whether the right term is a fact
+	RightFact bool
+	// RightValue compared right value
+	RightValue interface{}
+	// RightMissing the right fact is not present into the context, so the zero value was compared
+	RightMissing bool
+	// Negated whether the condition is negated
+	Negated bool
+	// Result condition result, negation included
+	Result bool
+}
+
+// String human-readable explanation
+func (e *Explanation) String() string {
+	sb := strings.Builder{}
+
+	status := "activated"
+	if e.Disabled {
+		status = "disabled"
+	} else if !e.Effective {
+		status = "not effective"
+	} else if !e.Activated {
+		status = "not activated"
+	}
+	sb.WriteString(fmt.Sprintf("rule %q when %s then %q: %s (version %d)\n", e.Rule, e.Operator, e.Then, status, e.Version))
+
+	blocking := map[string]struct{}{}
+	for _, token := range e.Blocking {
+		blocking[token] = struct{}{}
+	}
+
+	for _, c := range e.Conditions {
+		sb.WriteString(fmt.Sprintf("  %-5t %s", c.Result, c))
+		if _, ok := blocking[c.Token]; ok {
+			sb.WriteString(" <- blocking")
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+// String human-readable condition explanation
+func (c ConditionExplanation) String() string {
+	not := emptyStr
+	if c.Negated {
+		not = "not "
+	}
+
+	values := explainValue(c.Left, c.LeftValue, c.LeftMissing)
+	if c.RightFact {
+		values += ", " + explainValue(c.Right, c.RightValue, c.RightMissing)
+	}
+
+	return fmt.Sprintf("%s%s %s %s (%s)", not, c.Left, c.Operator, c.Right, values)
+}
+
+// explainValue formats a compared value
+func explainValue(term string, value interface{}, missing bool) string {
+	if missing {
+		return fmt.Sprintf("%s is missing", term)
+	}
+	return fmt.Sprintf("%s=%v", term, value)
+}
@@ -0,0 +1,30 @@
+package goldfish_re
+
+// Future handle of an asynchronous update that yields its activations and final error once it is evaluated
+type Future struct {
+	done        chan struct{}
+	activations []Activation
+	err         error
+}
+
+// newFuture future constructor
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+// resolve sets the update result and releases the waiting callers
+func (f *Future) resolve(activations []Activation, err error) {
+	f.activations, f.err = activations, err
+	close(f.done)
+}
+
+// Done returns a channel closed when the update has been evaluated
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the update has been evaluated returning the same as UpdateWithActivations
+func (f *Future) Wait() ([]Activation, error) {
+	<-f.done
+	return f.activations, f.err
+}
@@ -0,0 +1,56 @@
+package goldfish_re
+
+import "time"
+
+// RuleInfo rule metadata
+type RuleInfo struct {
+	// Id rule identifier
+	Id string
+	// Name human-facing rule name
+	Name string
+	// Description rule description
+	Description string
+	// Owner team or person that owns the rule
+	Owner string
+	// Tags rule tags
+	Tags []string
+	// Salience rule priority into the agenda
+	Salience int
+	// Enabled whether the rule can be activated
+	Enabled bool
+	// EffectiveFrom time since the rule can be activated, zero if unbounded
+	EffectiveFrom time.Time
+	// EffectiveUntil time since the rule cannot be activated anymore, zero if unbounded
+	EffectiveUntil time.Time
+	// Then rule then value
+	Then string
+}
+
+// newRuleInfo builds the metadata of the given rule
+func newRuleInfo(r *_rule) RuleInfo {
+	return RuleInfo{
+		Id:             r.token,
+		Name:           r.name,
+		Description:    r.description,
+		Owner:          r.owner,
+		Tags:           append([]string{}, r.tags...),
+		Salience:       r.salience,
+		Enabled:        !r.disabled,
+		EffectiveFrom:  r.effectiveFrom,
+		EffectiveUntil: r.effectiveUntil,
+		Then:           r.then,
+	}
+}
+
+// RuleLifecycle reports a rule that became effective or expired according to its effective window.
+// Changes are detected by the first evaluation after they happen.
+type RuleLifecycle struct {
+	// Rule rule identifier
+	Rule string
+	// Name rule name
+	Name string
+	// Effective true if the rule became effective, false if it expired
+	Effective bool
+	// At time of the evaluation that detected the change
+	At time.Time
+}
@@ -1,25 +1,262 @@
 package goldfish_re
 
-import "sync"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
 
 // Ruleset interface to expose available actions to do with a ruleset
 type Ruleset interface {
-	AddRule(r *_rule)
+	AddRule(r *_rule) error
+	RemoveRule(id string) error
+	ReplaceRule(id string, r *_rule) error
+	EnableRule(id string) error
+	DisableRule(id string) error
+	Rules() []RuleInfo
+	RulesByTag(tag string) []RuleInfo
+	LoadJSON(data []byte) error
+	LoadYAML(data []byte) error
+	ExportJSON() ([]byte, error)
+	ExportYAML() ([]byte, error)
+	NewVersion() Ruleset
+	Swap(next Ruleset) (uint64, error)
+	Version() uint64
+	Evaluate(facts map[string]interface{}) ([]Activation, error)
 	Context() *factContext
 	//EvalFacts(ctx *factContext)
 }
 
-// ruleset wrapper to export methods
+// rulesetVersion compiled ruleset published under a version number with the configuration used to dispatch it
+type rulesetVersion struct {
+	version     uint64
+	rs          *_ruleset
+	strategy    tStrategy
+	hitPolicy   tHitPolicy
+	lifecycleFn func(RuleLifecycle)
+}
+
+// ruleset wrapper to export methods.
+// Holds the current ruleset version which can be atomically swapped while contexts are alive.
 type ruleset struct {
 	mtx       sync.Mutex
-	rs        *_ruleset
+	versions  uint64
+	curr      atomic.Value
+	swapped   uint32 // set once the ruleset was published by Swap into another one, then it is read-only
 	successFn func(string, Context)
 	errorFn   func(error)
 }
 
+// newRulesetWrapper ruleset wrapper constructor publishing the given ruleset version as version 1
+func newRulesetWrapper(v rulesetVersion, successFn func(string, Context), errorFn func(error)) *ruleset {
+	w := &ruleset{successFn: successFn, errorFn: errorFn}
+	w.publish(v)
+	return w
+}
+
+// publish stores the given compiled ruleset and configuration as the current version
+func (rs *ruleset) publish(v rulesetVersion) uint64 {
+	v.version = atomic.AddUint64(&rs.versions, 1)
+	rs.curr.Store(&v)
+	return v.version
+}
+
+// version returns the current ruleset version
+func (rs *ruleset) version() *rulesetVersion {
+	return rs.curr.Load().(*rulesetVersion)
+}
+
+// current returns the current compiled ruleset
+func (rs *ruleset) current() *_ruleset {
+	return rs.version().rs
+}
+
+// writable returns the current compiled ruleset to be modified, failing once the ruleset was swapped into another one
+func (rs *ruleset) writable() (*_ruleset, error) {
+	if atomic.LoadUint32(&rs.swapped) == 1 {
+		return nil, ErrRulesetSwapped
+	}
+	return rs.current(), nil
+}
+
+// NewVersion returns a new empty ruleset with the same handlers and configuration. It can be populated off to the side
+// while contexts keep evaluating the current version, and then published via Swap.
+func (rs *ruleset) NewVersion() Ruleset {
+	curr := rs.version()
+	next := newRuleset()
+	next.name = curr.rs.name
+	next.description = curr.rs.description
+	next.schema = curr.rs.schema
+	next.clock = curr.rs.clock
+	return newRulesetWrapper(rulesetVersion{rs: next, strategy: curr.strategy, hitPolicy: curr.hitPolicy,
+		lifecycleFn: curr.lifecycleFn}, rs.successFn, rs.errorFn)
+}
+
+// Swap atomically publishes the rules and configuration (strategy, hit policy and lifecycle handler) of the given
+// ruleset as the new version of this one returning its version number. The activation and error handlers of this one
+// are kept. Each context evaluates its next Update against the new version, running updates finish with the previous one.
+// The given ruleset shares its rules with this one after the swap, so it becomes read-only: its changes fail with
+// ErrRulesetSwapped, as swapping it again does.
+func (rs *ruleset) Swap(next Ruleset) (uint64, error) {
+	n, ok := next.(*ruleset)
+	if !ok || n == nil || n == rs {
+		return 0, ErrInvalidRulesetVersion
+	}
+	if !atomic.CompareAndSwapUint32(&n.swapped, 0, 1) {
+		return 0, ErrRulesetSwapped
+	}
+	return rs.publish(*n.version()), nil
+}
+
+// Version returns the current ruleset version number
+func (rs *ruleset) Version() uint64 {
+	return rs.version().version
+}
+
 // AddRule adds a new rule to the ruleset.
-func (rs *ruleset) AddRule(r *_rule) {
-	rs.rs.addRule(r)
+// Returns ErrRuleAddedPreviously if a rule with the same identifier is already present.
+func (rs *ruleset) AddRule(r *_rule) error {
+	compiled, err := rs.writable()
+	if err != nil {
+		return err
+	}
+	return compiled.addRule(r)
+}
+
+// RemoveRule removes the rule with the given identifier from the ruleset.
+// Conditions that are not used by other rules are removed too. It is safe to call it while contexts are evaluated.
+func (rs *ruleset) RemoveRule(id string) error {
+	compiled, err := rs.writable()
+	if err != nil {
+		return err
+	}
+	return compiled.removeRule(id)
+}
+
+// ReplaceRule atomically replaces the rule with the given identifier by the given rule, which keeps the same identifier.
+func (rs *ruleset) ReplaceRule(id string, r *_rule) error {
+	compiled, err := rs.writable()
+	if err != nil {
+		return err
+	}
+	return compiled.replaceRule(id, r)
+}
+
+// EnableRule enables the rule with the given identifier at runtime
+func (rs *ruleset) EnableRule(id string) error {
+	compiled, err := rs.writable()
+	if err != nil {
+		return err
+	}
+	return compiled.enableRule(id, true)
+}
+
+// DisableRule disables the rule with the given identifier at runtime, it is not activated until it is enabled again
+func (rs *ruleset) DisableRule(id string) error {
+	compiled, err := rs.writable()
+	if err != nil {
+		return err
+	}
+	return compiled.enableRule(id, false)
+}
+
+// Rules returns the metadata of the ruleset rules in definition order
+func (rs *ruleset) Rules() []RuleInfo {
+	return rs.current().rulesInfo(emptyStr)
+}
+
+// RulesByTag returns the metadata of the rules tagged with the given tag in definition order
+func (rs *ruleset) RulesByTag(tag string) []RuleInfo {
+	return rs.current().rulesInfo(tag)
+}
+
+// LoadJSON adds the conditions and rules declared into the given JSON document.
+// The whole document is validated before adding any rule, it is loaded whole or not at all.
+func (rs *ruleset) LoadJSON(data []byte) error {
+	def := &rulesetDefinition{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(def); err != nil {
+		return definitionError("%s", err)
+	}
+	compiled, err := rs.writable()
+	if err != nil {
+		return err
+	}
+	return compiled.load(def)
+}
+
+// LoadYAML adds the conditions and rules declared into the given YAML document.
+// The whole document is validated before adding any rule, it is loaded whole or not at all.
+func (rs *ruleset) LoadYAML(data []byte) error {
+	def := &rulesetDefinition{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(def); err != nil {
+		return definitionError("%s", err)
+	}
+	compiled, err := rs.writable()
+	if err != nil {
+		return err
+	}
+	return compiled.load(def)
+}
+
+// ExportJSON serializes the ruleset conditions and rules as a JSON document that can be loaded again via LoadJSON
+func (rs *ruleset) ExportJSON() ([]byte, error) {
+	return json.MarshalIndent(rs.current().definition(), emptyStr, "  ")
+}
+
+// ExportYAML serializes the ruleset conditions and rules as a YAML document that can be loaded again via LoadYAML
+func (rs *ruleset) ExportYAML() ([]byte, error) {
+	return yaml.Marshal(rs.current().definition())
+}
+
+// Evaluate runs a one-shot evaluation of the given facts (keyed as Object.attribute) returning the activated rules.
+// The activation handler is not called and the given values are not kept into the ruleset index,
+// so it is suitable for request/response services that don't need a long-lived context.
+func (rs *ruleset) Evaluate(facts map[string]interface{}) ([]Activation, error) {
+	version := rs.version()
+	ctx := _factContext{}
+	for token, v := range facts {
+		object, attribute, ok := splitToken(token)
+		if !ok {
+			return nil, ErrMalformedFact
+		}
+
+		value, ok := factValue(v)
+		if !ok {
+			return nil, ErrInvalidValueType
+		}
+		fact := newFact(object, attribute, value)
+		if err := version.rs.schema.checkFact(fact); err != nil {
+			return nil, err
+		}
+		ctx.set(fact)
+	}
+
+	// one-shot evaluations don't take the ruleset lock, so they can be called from the handlers
+	activations := make([]Activation, 0)
+	rs.lifecycle(version)
+
+	activated, activatedBm, errs := version.rs.safeEvalFactsWithoutIndex(ctx)
+	rs.fail(errs...)
+
+	rules, err := version.hitPolicy.apply(agenda(activated, version.strategy, nil))
+	if err != nil {
+		rs.fail(err)
+		return activations, err
+	}
+
+	for _, r := range rules {
+		activations = append(activations, newActivation(r, activatedBm, ctx, version.version, 0))
+	}
+	return activations, nil
 }
 
 // Context returns a new fact context with the ruleset attached.
@@ -28,34 +265,113 @@ func (rs *ruleset) Context() *factContext {
 	return newContext(rs)
 }
 
-// evalFacts thread-safe ruleset evaluation with the given context.
-func (rs *ruleset) evalFacts(ctx *factContext) {
-	rs.mtx.Lock()
-	defer rs.mtx.Unlock()
+// fail calls the error handler with each one of the given errors.
+// It must be called without holding the ruleset lock, so the error handler can use the ruleset too.
+func (rs *ruleset) fail(errs ...error) {
+	if rs.errorFn == nil {
+		return
+	}
 
-	activated := rs.rs.evalFacts(ctx.iFactRef)
-	for _, r := range activated {
-		if r != nil {
-			rs.successFn(r.then, ctx)
+	for _, err := range errs {
+		rs.errorFn(err)
+	}
+}
+
+// dispatch calls the activation handler with the given rule recovering its panics as *EvalError, which is returned.
+// The activation is available from the context while the handler runs, and the rule actions are requested
+// as feedback after it.
+func (rs *ruleset) dispatch(r *_rule, a Activation, ctx *factContext) (err error) {
+	ctx.activation = &a
+	atomic.StoreUint64(&ctx.handler, goroutineID())
+	defer func() {
+		atomic.StoreUint64(&ctx.handler, 0)
+		ctx.activation = nil
+		if rec := recover(); rec != nil {
+			err = &EvalError{Rule: r.token, RuleName: r.name, Cause: fmt.Errorf("%w: %v", ErrActivationRecovered, rec)}
+			if ctx.recovered == nil {
+				ctx.recovered = err
+			}
 		}
+		ctx.feedbackActions(r.actions)
+	}()
+
+	rs.successFn(r.then, ctx)
+	return nil
+}
+
+// lifecycle calls the lifecycle handler with the rules of the given ruleset that became effective or expired.
+// Each change is returned once by the compiled ruleset, so the ruleset lock is not required.
+func (rs *ruleset) lifecycle(v *rulesetVersion) {
+	events := v.rs.lifecycle()
+	if v.lifecycleFn == nil {
+		return
+	}
+
+	for _, e := range events {
+		v.lifecycleFn(e)
 	}
 }
 
-// evalFactsWithSkip thread-safe ruleset evaluation with the given context.
-func (rs *ruleset) evalFactsWithSkip(ctx *factContext, skip map[string]struct{}) map[string]struct{} {
+// agenda returns the activated rules to dispatch ordered by the agenda and filtered by the hit policy
+// of the version pinned by the context update
+func (rs *ruleset) agenda(activated []*_rule, ctx *factContext) ([]*_rule, error) {
+	return ctx.version.hitPolicy.apply(agenda(activated, ctx.version.strategy, ctx.recencyOf))
+}
+
+// evalFacts thread-safe ruleset evaluation with the given context.
+// The evaluated ruleset is the version pinned by the context update.
+func (rs *ruleset) evalFacts(ctx *factContext) []Activation {
+	_, activations := rs.evalFactsWithSkip(ctx, map[string]struct{}{}, 0)
+	return activations
+}
+
+// evalFactsWithSkip thread-safe ruleset evaluation with the given context dispatching the activations ordered by the agenda.
+// The evaluated ruleset is the version pinned by the context update.
+// The rules whose then value is skipped are discarded before applying the hit policy.
+// Returns the then values to skip on the next feedback iteration and the dispatched activations.
+// The errors found are sent to the error handler once the ruleset lock is released.
+func (rs *ruleset) evalFactsWithSkip(ctx *factContext, skip map[string]struct{}, iteration int) (map[string]struct{}, []Activation) {
+	toSkip, activations, errs := rs.dispatchAgenda(ctx, skip, iteration)
+	rs.fail(errs...)
+	return toSkip, activations
+}
+
+// dispatchAgenda evaluates the ruleset with the given context dispatching the activations ordered by the agenda
+// under the ruleset lock. Returns the then values to skip on the next feedback iteration, the dispatched activations
+// and the errors found.
+func (rs *ruleset) dispatchAgenda(ctx *factContext, skip map[string]struct{}, iteration int) (map[string]struct{}, []Activation, []error) {
 	rs.mtx.Lock()
 	defer rs.mtx.Unlock()
 
 	toSkip := map[string]struct{}{}
-	activated := rs.rs.evalFacts(ctx.iFactRef)
+	activations := make([]Activation, 0)
+	rs.lifecycle(ctx.version)
+	activated, activatedBm, errs := ctx.version.rs.safeEvalFacts(ctx.iFactRef)
+	ctx.halted = false
+	notSkipped := make([]*_rule, 0, len(activated))
 	for _, r := range activated {
-		if r != nil {
-			if _, skipped := skip[r.then]; skipped {
-				continue
-			}
-			toSkip[r.then] = struct{}{}
-			rs.successFn(r.then, ctx)
+		if r == nil {
+			continue
+		}
+		if _, skipped := skip[r.then]; !skipped {
+			notSkipped = append(notSkipped, r)
+		}
+	}
+
+	rules, err := rs.agenda(notSkipped, ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, r := range rules {
+		toSkip[r.then] = struct{}{}
+		a := newActivation(r, activatedBm, ctx.iFactRef, ctx.version.version, iteration)
+		activations = append(activations, a)
+		if err := rs.dispatch(r, a, ctx); err != nil {
+			errs = append(errs, err)
+		}
+		if ctx.stopped() {
+			break
 		}
 	}
-	return toSkip
+	return toSkip, activations, errs
 }
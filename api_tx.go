@@ -5,8 +5,12 @@ import "time"
 // Tx transaction struct
 type Tx struct {
 	err     error
+	errFact string
 	userErr error
 	toApply map[interface{}]interface{}
+
+	accumulated map[interface{}]struct{}    // facts whose preset value was computed from its previous value
+	staged      map[interface{}]interface{} // values set by previous coalesced updates of the batch, read-only
 }
 
 // newTx transaction constructor
@@ -24,6 +28,38 @@ func (tx *Tx) Error(err error) {
 	tx.userErr = err
 }
 
+// fail sets the lib error keeping the token of the fact that produced it
+func (tx *Tx) fail(object interface{}, err error) {
+	tx.err = err
+	if f, ok := object.(interface{ token() string }); ok {
+		tx.errFact = f.token()
+	}
+}
+
+// evalError returns the lib error as *EvalError to notify the ruleset error handler
+func (tx *Tx) evalError() error {
+	return &EvalError{Fact: tx.errFact, Cause: tx.err}
+}
+
+// accumulate presets the value computed from the fact previous value, so it doesn't conflict with previous feedbacks
+func (tx *Tx) accumulate(object interface{}, value interface{}) {
+	tx.preset(object, value)
+	if tx.accumulated != nil {
+		tx.accumulated[object] = struct{}{}
+	}
+}
+
+// tokens returns the tokens of the facts updated by the transaction
+func (tx *Tx) tokens() []string {
+	tokens := make([]string, 0, len(tx.toApply))
+	for obj := range tx.toApply {
+		if f, ok := obj.(interface{ token() string }); ok {
+			tokens = append(tokens, f.token())
+		}
+	}
+	return tokens
+}
+
 // commit apply the transaction operations on the target facts
 func (tx *Tx) commit() {
 	for obj, val := range tx.toApply {
@@ -38,34 +74,34 @@ func (tx *Tx) set(object interface{}, value interface{}) {
 		if str, ok := value.(string); ok {
 			obj.set(str)
 		} else {
-			tx.err = ErrInvalidValueType
+			tx.fail(obj, ErrInvalidValueType)
 		}
 	case Number:
 		if num, ok := value.(int64); ok {
 			obj.set(num)
 		} else {
-			tx.err = ErrInvalidValueType
+			tx.fail(obj, ErrInvalidValueType)
 		}
 	case Float:
 		if num, ok := value.(float64); ok {
 			obj.set(num)
 		} else {
-			tx.err = ErrInvalidValueType
+			tx.fail(obj, ErrInvalidValueType)
 		}
 	case Boolean:
 		if b, ok := value.(bool); ok {
 			obj.set(b)
 		} else {
-			tx.err = ErrInvalidValueType
+			tx.fail(obj, ErrInvalidValueType)
 		}
 	case Date:
 		if d, ok := value.(time.Time); ok {
 			obj.set(d)
 		} else {
-			tx.err = ErrInvalidValueType
+			tx.fail(obj, ErrInvalidValueType)
 		}
 	default:
-		tx.err = ErrInvalidDataType
+		tx.fail(object, ErrInvalidDataType)
 	}
 }
 
@@ -76,34 +112,34 @@ func (tx *Tx) preset(object interface{}, value interface{}) {
 		if _, ok := value.(string); ok {
 			tx.toApply[obj] = value
 		} else {
-			tx.err = ErrInvalidValueType
+			tx.fail(obj, ErrInvalidValueType)
 		}
 	case Number:
 		if _, ok := value.(int64); ok {
 			tx.toApply[obj] = value
 		} else {
-			tx.err = ErrInvalidValueType
+			tx.fail(obj, ErrInvalidValueType)
 		}
 	case Float:
 		if _, ok := value.(float64); ok {
 			tx.toApply[obj] = value
 		} else {
-			tx.err = ErrInvalidValueType
+			tx.fail(obj, ErrInvalidValueType)
 		}
 	case Boolean:
 		if _, ok := value.(bool); ok {
 			tx.toApply[obj] = value
 		} else {
-			tx.err = ErrInvalidValueType
+			tx.fail(obj, ErrInvalidValueType)
 		}
 	case Date:
 		if _, ok := value.(time.Time); ok {
 			tx.toApply[obj] = value
 		} else {
-			tx.err = ErrInvalidValueType
+			tx.fail(obj, ErrInvalidValueType)
 		}
 	default:
-		tx.err = ErrInvalidDataType
+		tx.fail(object, ErrInvalidDataType)
 	}
 }
 
@@ -131,3 +167,60 @@ func (tx *Tx) SetBoolean(object Boolean, value bool) {
 func (tx *Tx) SetDate(object Date, value time.Time) {
 	tx.preset(object, value)
 }
+
+// value returns the value of the given fact seen by the transaction: the preset one, the one staged by previous
+// coalesced updates or the current one
+func (tx *Tx) value(object interface{}) interface{} {
+	if v, ok := tx.toApply[object]; ok {
+		return v
+	}
+	if v, ok := tx.staged[object]; ok {
+		return v
+	}
+	return factKindValue(object)
+}
+
+// GetString returns the value of the given fact seen by the transaction, including the value preset by it
+func (tx *Tx) GetString(object String) string {
+	v, _ := tx.value(object).(string)
+	return v
+}
+
+// GetNumber returns the value of the given fact seen by the transaction, including the value preset by it
+func (tx *Tx) GetNumber(object Number) int64 {
+	v, _ := tx.value(object).(int64)
+	return v
+}
+
+// GetFloat returns the value of the given fact seen by the transaction, including the value preset by it
+func (tx *Tx) GetFloat(object Float) float64 {
+	v, _ := tx.value(object).(float64)
+	return v
+}
+
+// GetBoolean returns the value of the given fact seen by the transaction, including the value preset by it
+func (tx *Tx) GetBoolean(object Boolean) bool {
+	v, _ := tx.value(object).(bool)
+	return v
+}
+
+// GetDate returns the value of the given fact seen by the transaction, including the value preset by it
+func (tx *Tx) GetDate(object Date) time.Time {
+	v, _ := tx.value(object).(time.Time)
+	return v
+}
+
+// IncrementNumber preset the given fact with its transaction value incremented by the given int64 value
+func (tx *Tx) IncrementNumber(object Number, by int64) {
+	tx.accumulate(object, tx.GetNumber(object)+by)
+}
+
+// IncrementFloat preset the given fact with its transaction value incremented by the given float64 value
+func (tx *Tx) IncrementFloat(object Float, by float64) {
+	tx.accumulate(object, tx.GetFloat(object)+by)
+}
+
+// AppendString preset the given fact with its transaction value followed by the given string value
+func (tx *Tx) AppendString(object String, value string) {
+	tx.accumulate(object, tx.GetString(object)+value)
+}
@@ -0,0 +1,51 @@
+package goldfish_re
+
+import "sync"
+
+// asyncUpdate update submitted via UpdateAsync
+type asyncUpdate struct {
+	fn     func(tx *Tx)
+	future *Future
+}
+
+// asyncQueue per context queue of asynchronous updates.
+// A single worker goroutine evaluates them in submission order and exits once the queue is empty.
+type asyncQueue struct {
+	mtx     sync.Mutex
+	pending []asyncUpdate
+	running bool
+}
+
+// push enqueues the given update returning whether a worker must be started
+func (q *asyncQueue) push(u asyncUpdate) bool {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	q.pending = append(q.pending, u)
+	start := !q.running
+	q.running = true
+	return start
+}
+
+// pop dequeues the next update. The worker must exit when there are not pending updates
+func (q *asyncQueue) pop() (asyncUpdate, bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if len(q.pending) == 0 {
+		q.running = false
+		return asyncUpdate{}, false
+	}
+
+	u := q.pending[0]
+	q.pending[0] = asyncUpdate{}
+	q.pending = q.pending[1:]
+	return u, true
+}
+
+// work evaluates the pending updates with the given update function until the queue is empty
+func (q *asyncQueue) work(update func(fn func(tx *Tx)) ([]Activation, error)) {
+	for u, ok := q.pop(); ok; u, ok = q.pop() {
+		u.future.resolve(update(u.fn))
+	}
+}
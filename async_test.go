@@ -0,0 +1,39 @@
+package goldfish_re
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_async_updateAsync(t *testing.T) {
+	miles := NewNumber("User", "miles", 0)
+	ctx := newTestContext(t, newTestRuleset(), `rule "many" when all { User.miles > 50 } then "MANY"`, miles)
+
+	seen := make([]int64, 0)
+	futures := make([]*Future, 0)
+	for i := int64(1); i <= 100; i++ {
+		n := i
+		futures = append(futures, ctx.UpdateAsync(func(tx *Tx) {
+			seen = append(seen, n)
+			tx.SetNumber(miles, n)
+		}))
+	}
+
+	activations, err := futures[99].Wait()
+	assert.Nil(t, err)
+	assert.Len(t, activations, 1)
+	assert.EqualValues(t, 100, miles.Value())
+	for i, n := range seen {
+		assert.EqualValues(t, i+1, n)
+	}
+
+	<-futures[0].Done()
+	activations, err = futures[0].Wait()
+	assert.Nil(t, err)
+	assert.Len(t, activations, 0)
+
+	future := ctx.UpdateAsync(func(tx *Tx) { tx.preset(miles, "many") })
+	_, err = future.Wait()
+	assert.ErrorIs(t, err, ErrInvalidValueType)
+}
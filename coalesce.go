@@ -0,0 +1,94 @@
+package goldfish_re
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// coalescer merges the updates arriving within a time window, or up to a max amount of updates,
+// into a single transaction evaluated once. The last value set to each fact wins.
+type coalescer struct {
+	mtx      sync.Mutex
+	flushMtx sync.Mutex // keeps the evaluation order of the flushed batches
+	window   time.Duration
+	max      int
+
+	pending []func(tx *Tx) // update functions of the current batch in arrival order
+	timer   *time.Timer
+}
+
+// newCoalescer coalescer constructor, a zero window or max disables that limit
+func newCoalescer(window time.Duration, max int) *coalescer {
+	return &coalescer{window: window, max: max}
+}
+
+// stage keeps the update function to be applied by the flush of the current batch.
+// Returns whether the max amount of updates was reached and the batch must be flushed, and whether a timer must be started.
+func (c *coalescer) stage(fn func(tx *Tx)) (full bool, timed bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.pending = append(c.pending, fn)
+	full = c.max > 0 && len(c.pending) >= c.max
+	return full, !full && c.window > 0 && c.timer == nil
+}
+
+// schedule starts the window timer that flushes the current batch
+func (c *coalescer) schedule(flush func()) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.timer == nil && len(c.pending) > 0 {
+		c.timer = time.AfterFunc(c.window, flush)
+	}
+}
+
+// take returns the current batch starting a new one
+func (c *coalescer) take() []func(tx *Tx) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	pending := c.pending
+	c.pending = nil
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	return pending
+}
+
+// applyBatch runs each update function of the batch into its own transaction reading the values set by the previous ones,
+// presetting the values of the succeeded ones into the given transaction. Failed transactions are discarded and
+// its errors are returned.
+func applyBatch(pending []func(tx *Tx), tx *Tx) []error {
+	errs := make([]error, 0)
+	for _, fn := range pending {
+		staged, err := stageTx(fn, tx.toApply)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for obj, val := range staged.toApply {
+			tx.toApply[obj] = val
+		}
+	}
+	return errs
+}
+
+// stageTx runs the update function reading the given staged values and recovering its panics as ErrContextUpdateRecovered
+func stageTx(fn func(tx *Tx), staged map[interface{}]interface{}) (tx *Tx, err error) {
+	tx = newTx()
+	tx.staged = staged
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrContextUpdateRecovered, r)
+		}
+	}()
+
+	fn(tx)
+	if tx.err != nil {
+		return tx, tx.evalError()
+	}
+	return tx, tx.userErr
+}
@@ -0,0 +1,220 @@
+package goldfish_re
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_coalesce_update(t *testing.T) {
+	var evaluations int32
+	errs := make(chan error, 1)
+	rs := Builder().Ruleset().
+		OnActivation(func(string, Context) { atomic.AddInt32(&evaluations, 1) }).
+		OnError(func(err error) { errs <- err }).
+		Build()
+	miles, plan := NewNumber("User", "miles", 0), NewString("User", "plan", "silver")
+	ctx := newTestContext(t, rs, `rule "miles" when all { User.miles > 0 } then "MILES"`, miles, plan)
+
+	// up to N updates, last write wins
+	assert.Nil(t, ctx.WithCoalescing(0, 3))
+	assert.Nil(t, ctx.SetNumber(miles, 1))
+	assert.Nil(t, ctx.SetNumber(miles, 2))
+	assert.EqualValues(t, 0, miles.Value())
+	assert.Nil(t, ctx.SetNumber(miles, 3))
+	assert.EqualValues(t, 3, miles.Value())
+	assert.EqualValues(t, 1, atomic.LoadInt32(&evaluations))
+
+	// combined errors, failed updates are discarded
+	assert.Nil(t, ctx.Update(func(tx *Tx) { tx.preset(plan, int64(1)) }))
+	assert.Nil(t, ctx.Update(func(tx *Tx) { tx.Error(errors.New("custom")) }))
+	err := ctx.SetString(plan, "gold")
+	var coalescedErr *CoalescedError
+	if assert.True(t, errors.As(err, &coalescedErr)) {
+		assert.Len(t, coalescedErr.Errors, 2)
+	}
+	assert.ErrorIs(t, err, ErrInvalidValueType)
+	assert.EqualValues(t, "gold", plan.Value())
+
+	// explicit flush
+	assert.Nil(t, ctx.SetNumber(miles, 4))
+	assert.Nil(t, ctx.Flush())
+	assert.EqualValues(t, 4, miles.Value())
+	assert.Nil(t, ctx.Flush())
+
+	// time window
+	assert.Nil(t, ctx.WithCoalescing(10*time.Millisecond, 0))
+	assert.Nil(t, ctx.Update(func(tx *Tx) { tx.Error(errors.New("custom")) }))
+	assert.Nil(t, ctx.SetNumber(miles, 5))
+	select {
+	case err := <-errs:
+		assert.True(t, errors.As(err, &coalescedErr))
+		assert.EqualValues(t, "1 coalesced update errors: custom", err.Error())
+	case <-time.After(time.Second):
+		assert.Fail(t, "the coalesced updates were not flushed")
+	}
+	assert.EqualValues(t, 5, miles.Value())
+}
+
+func Test_coalesce_reconfigure(t *testing.T) {
+	errs := make(chan error, 1)
+	rs := Builder().Ruleset().
+		OnActivation(func(string, Context) {}).
+		OnError(func(err error) { errs <- err }).
+		Build()
+
+	miles := NewNumber("User", "miles", 0)
+	ctx := newTestContext(t, rs, emptyStr, miles)
+
+	// disabled before the window, the old timer does not flush the new configuration
+	assert.Nil(t, ctx.WithCoalescing(20*time.Millisecond, 0))
+	assert.Nil(t, ctx.SetNumber(miles, 7))
+	assert.Nil(t, ctx.WithCoalescing(0, 0))
+	assert.EqualValues(t, 7, miles.Value())
+	time.Sleep(40 * time.Millisecond)
+	assert.Len(t, errs, 0)
+
+	// new max amount
+	assert.Nil(t, ctx.WithCoalescing(0, 10))
+	assert.Nil(t, ctx.SetNumber(miles, 9))
+	assert.Nil(t, ctx.WithCoalescing(0, 5))
+	assert.EqualValues(t, 9, miles.Value())
+	assert.Nil(t, ctx.Flush())
+	assert.EqualValues(t, 9, miles.Value())
+
+	// errors of the previous batch
+	assert.Nil(t, ctx.Update(func(tx *Tx) { tx.Error(errors.New("custom")) }))
+	assert.EqualError(t, ctx.WithCoalescing(0, 0), "1 coalesced update errors: custom")
+}
+
+func Test_coalesce_concurrent(t *testing.T) {
+	var hold sync.Once
+	running, release := make(chan struct{}), make(chan struct{})
+	rs := Builder().Ruleset().
+		OnActivation(func(string, Context) {
+			hold.Do(func() {
+				close(running)
+				<-release
+			})
+		}).
+		OnError(func(error) {}).
+		Build()
+	plan, points := NewString("User", "plan", "silver"), NewNumber("User", "points", 0)
+	ctx := newTestContext(t, rs, `rule "gold" when all { User.plan == "gold" } then "GOLD"`, plan, points)
+	increment := func(tx *Tx) { tx.IncrementNumber(points, 1) }
+
+	// batches flushed while another update holds the context
+	assert.Nil(t, ctx.WithCoalescing(0, 2))
+	done := make(chan error)
+	go func() {
+		_, err := ctx.UpdateWithActivations(func(tx *Tx) { tx.SetString(plan, "gold") })
+		done <- err
+	}()
+	<-running
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, ctx.Update(increment))
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	assert.Nil(t, <-done)
+	wg.Wait()
+	assert.EqualValues(t, 4, points.Value())
+
+	// coalesced updates mixed with direct ones
+	assert.Nil(t, ctx.WithCoalescing(time.Millisecond, 3))
+	for i := 0; i < 25; i++ {
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, ctx.Update(increment))
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := ctx.UpdateWithActivations(increment)
+			assert.Nil(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, ctx.UpdateContext(context.Background(), increment))
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := ctx.UpdateAsync(increment).Wait()
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Nil(t, ctx.Flush())
+	assert.EqualValues(t, 104, points.Value())
+}
+
+func Test_coalesce_flushFromHandler(t *testing.T) {
+	var ctx *factContext
+	var once sync.Once
+	var flushErr, configErr error
+	miles, points := NewNumber("User", "miles", 0), NewNumber("User", "points", 0)
+	rs := Builder().Ruleset().
+		OnActivation(func(string, Context) {
+			once.Do(func() {
+				staged := make(chan error)
+				go func() { staged <- ctx.SetNumber(points, 5) }()
+				assert.Nil(t, <-staged)
+				flushErr = ctx.Flush()
+				configErr = ctx.WithCoalescing(0, 0)
+			})
+		}).
+		OnError(func(error) {}).
+		Build()
+	ctx = newTestContext(t, rs, `rule "miles" when all { User.miles > 0 } then "MILES"`, miles, points)
+	assert.Nil(t, ctx.WithCoalescing(0, 2))
+
+	// the handler of the flushed batch flushes the updates staged meanwhile and disables the coalescing
+	assert.Nil(t, ctx.SetNumber(miles, 1))
+	done := make(chan error)
+	go func() { done <- ctx.SetNumber(miles, 2) }()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		assert.FailNow(t, "the flush from the activation handler deadlocked")
+	}
+	assert.Nil(t, flushErr)
+	assert.Nil(t, configErr)
+	assert.EqualValues(t, 2, miles.Value())
+	assert.EqualValues(t, 5, points.Value())
+	assert.Nil(t, ctx.coalescer())
+}
+
+func Test_coalesce_reconfigureConcurrently(t *testing.T) {
+	points := NewNumber("User", "points", 0)
+	ctx := newTestContext(t, newTestRuleset(), emptyStr, points)
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			assert.Nil(t, ctx.Update(func(tx *Tx) { tx.IncrementNumber(points, 1) }))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			assert.Nil(t, ctx.WithCoalescing(0, i%3))
+		}
+	}()
+	wg.Wait()
+	assert.Nil(t, ctx.WithCoalescing(0, 0))
+	assert.EqualValues(t, 50, points.Value())
+}
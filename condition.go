@@ -1,6 +1,8 @@
 package goldfish_re
 
 import (
+	"fmt"
+	"runtime"
 	"strings"
 	"time"
 )
@@ -56,6 +58,17 @@ func (c *_condition) addRule(r *_rule) {
 	c.ruleSlice = append(c.ruleSlice, r) // TODO set slice capacity and use RUID as slice index
 }
 
+// removeRule unlink the given rule from the condition returning the amount of rules still linked
+func (c *_condition) removeRule(r *_rule) int {
+	for i, rr := range c.ruleSlice {
+		if rr == r {
+			c.ruleSlice = append(c.ruleSlice[:i:i], c.ruleSlice[i+1:]...)
+			break
+		}
+	}
+	return len(c.ruleSlice)
+}
+
 // eval evaluate the condition with a given fact and context
 func (c *_condition) eval(fact iFact, ctx _factContext) (bool, iFact) {
 
@@ -108,6 +121,31 @@ func (c *_condition) eval(fact iFact, ctx _factContext) (bool, iFact) {
 	return c.negated != result, nil
 }
 
+// safeEval same as eval but recovers the type assertion failures produced when the runtime type of a fact
+// doesn't match the condition data type, returning an *EvalError per linked rule.
+func (c *_condition) safeEval(fact iFact, ctx _factContext) (ok bool, relFact iFact, errs []error) {
+	defer func() {
+		if r := recover(); r != nil {
+			tErr, isTypeErr := r.(*runtime.TypeAssertionError)
+			if !isTypeErr {
+				panic(r)
+			}
+
+			ok, relFact = false, nil
+			cause := fmt.Errorf("%w: %s", ErrInvalidValueType, tErr)
+			for _, rule := range c.ruleSlice {
+				errs = append(errs, &EvalError{Rule: rule.token, RuleName: rule.name, Condition: c.token(), Fact: fact.token(), Cause: cause})
+			}
+			if len(errs) == 0 {
+				errs = append(errs, &EvalError{Condition: c.token(), Fact: fact.token(), Cause: cause})
+			}
+		}
+	}()
+
+	ok, relFact = c.eval(fact, ctx)
+	return ok, relFact, nil
+}
+
 // evalString eval string data type
 func evalString(fact iFact, rFact iFact, op tOperator) bool {
 	if op == opIn {
@@ -49,6 +49,12 @@ func (e tOperator) String() string {
 		return "contains"
 	case opIn:
 		return "in"
+	case opAfter:
+		return "after"
+	case opBefore:
+		return "before"
+	case opBetween:
+		return "between"
 	default:
 		return undefined
 	}
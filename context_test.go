@@ -0,0 +1,111 @@
+package goldfish_re
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCtxKey struct{}
+
+func Test_context_updateContext(t *testing.T) {
+	var cancel context.CancelFunc
+	values := make([]interface{}, 0)
+	rs := Builder().Ruleset().
+		OnActivation(func(then string, ctx Context) {
+			values = append(values, ctx.Context().Value(testCtxKey{}))
+			if then == "GOLD" {
+				cancel()
+			}
+		}).
+		OnError(func(error) {}).
+		Build()
+
+	plan, status := NewString("User", "plan", "silver"), NewString("User", "status", "active")
+	ctx := newTestContext(t, rs, `
+		rule "gold" when all { User.plan == "gold" } then "GOLD" { set User.status "VIP" }
+		rule "miles" when all { User.plan == "gold" } then "MILES"
+	`, plan, status)
+
+	c, cancelFn := context.WithCancel(context.WithValue(context.Background(), testCtxKey{}, "request"))
+	cancel = cancelFn
+	err := ctx.UpdateContext(c, func(tx *Tx) { tx.SetString(plan, "gold") })
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.EqualValues(t, []interface{}{"request"}, values)
+	assert.EqualValues(t, "gold", plan.Value())
+	assert.EqualValues(t, "active", status.Value())
+	assert.EqualValues(t, context.Background(), ctx.Context())
+
+	assert.ErrorIs(t, ctx.UpdateContext(c, func(tx *Tx) { tx.SetString(plan, "silver") }), context.Canceled)
+	assert.EqualValues(t, "gold", plan.Value())
+}
+
+func Test_context_updateContextWaiting(t *testing.T) {
+	running, release := make(chan struct{}), make(chan struct{})
+	rs := Builder().Ruleset().
+		OnActivation(func(string, Context) {
+			close(running)
+			<-release
+		}).
+		OnError(func(error) {}).
+		Build()
+
+	plan := NewString("User", "plan", "silver")
+	ctx := newTestContext(t, rs, `rule "gold" when all { User.plan == "gold" } then "GOLD"`, plan)
+
+	done := make(chan error)
+	go func() { done <- ctx.SetString(plan, "gold") }()
+	<-running
+
+	// the deadline expires while the other update holds the context
+	c, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, ctx.UpdateContext(c, func(tx *Tx) { tx.SetString(plan, "silver") }), context.DeadlineExceeded)
+
+	close(release)
+	assert.Nil(t, <-done)
+	assert.EqualValues(t, "gold", plan.Value())
+}
+
+func Test_context_rollback(t *testing.T) {
+	rs := Builder().Ruleset().
+		OnActivation(func(then string, ctx Context) {
+			switch then {
+			case "VIP":
+				panic("boom")
+			case "FAIL":
+				ctx.Feedback(func(tx *Tx) { tx.Error(errors.New("custom")) })
+			}
+		}).
+		OnError(func(error) {}).
+		Build()
+
+	plan, status, points := NewString("User", "plan", "silver"), NewString("User", "status", "active"), NewNumber("User", "points", 0)
+	ctx := newTestContext(t, rs, `
+		rule "gold" when all { User.plan == "gold" } then "GOLD" { set User.status "VIP"; increment User.points 10 }
+		rule "vip" when all { User.status == "VIP" } then "VIP"
+		rule "fail" when all { User.plan == "platinum" } then "FAIL" { increment User.points 5 }
+	`, plan, status, points)
+	ctx.WithRollback(true)
+
+	// activation handler panic into a feedback iteration
+	assert.ErrorIs(t, ctx.SetString(plan, "gold"), ErrActivationRecovered)
+	assert.EqualValues(t, "silver", plan.Value())
+	assert.EqualValues(t, "active", status.Value())
+	assert.EqualValues(t, 0, points.Value())
+
+	// feedback transaction error
+	assert.EqualError(t, ctx.SetString(plan, "platinum"), "custom")
+	assert.EqualValues(t, "silver", plan.Value())
+	assert.EqualValues(t, 0, points.Value())
+
+	// without rollback the committed values are kept
+	ctx.WithRollback(false)
+	assert.ErrorIs(t, ctx.SetString(plan, "gold"), ErrActivationRecovered)
+	assert.EqualValues(t, "gold", plan.Value())
+	assert.EqualValues(t, "VIP", status.Value())
+	assert.EqualValues(t, 10, points.Value())
+}
@@ -0,0 +1,456 @@
+package goldfish_re
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	whenAll     = "all"
+	whenAny     = "any"
+	whenNone    = "none"
+	whenAtLeast = "atleast"
+	whenAtMost  = "atmost"
+	whenExactly = "exactly"
+)
+
+// whenOperators rule and group operators by its definition name
+var whenOperators = map[string]tBinaryOperator{
+	whenAll:     opAnd,
+	whenAny:     opOr,
+	whenNone:    opNone,
+	whenAtLeast: opAtLeast,
+	whenAtMost:  opAtMost,
+	whenExactly: opExactly,
+}
+
+// whenName returns the definition name of the given rule operator
+func whenName(op tBinaryOperator) string {
+	for name, o := range whenOperators {
+		if o == op {
+			return name
+		}
+	}
+	return undefined
+}
+
+// rulesetDefinition declarative ruleset representation used to load and export rulesets as JSON or YAML documents
+type rulesetDefinition struct {
+	Name        string                `json:"name,omitempty" yaml:"name,omitempty"`
+	Description string                `json:"description,omitempty" yaml:"description,omitempty"`
+	Conditions  []conditionDefinition `json:"conditions" yaml:"conditions"`
+	Rules       []ruleDefinition      `json:"rules" yaml:"rules"`
+}
+
+// conditionDefinition declarative condition representation.
+// The right term is a discrete value or a reference (ref) to another fact.
+type conditionDefinition struct {
+	Id       string      `json:"id" yaml:"id"`
+	Term     string      `json:"term" yaml:"term"`
+	Type     string      `json:"type" yaml:"type"`
+	Operator string      `json:"operator" yaml:"operator"`
+	Value    interface{} `json:"value,omitempty" yaml:"value,omitempty"`
+	Ref      string      `json:"ref,omitempty" yaml:"ref,omitempty"`
+	Negated  bool        `json:"negated,omitempty" yaml:"negated,omitempty"`
+}
+
+// ruleDefinition declarative rule representation. Conditions are referenced by its definition id
+type ruleDefinition struct {
+	Id          string             `json:"id,omitempty" yaml:"id,omitempty"`
+	Name        string             `json:"name,omitempty" yaml:"name,omitempty"`
+	Description string             `json:"description,omitempty" yaml:"description,omitempty"`
+	Owner       string             `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Tags        []string           `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Disabled    bool               `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	From        string             `json:"effectiveFrom,omitempty" yaml:"effectiveFrom,omitempty"`
+	Until       string             `json:"effectiveUntil,omitempty" yaml:"effectiveUntil,omitempty"`
+	When        string             `json:"when" yaml:"when"`
+	Count       int                `json:"count,omitempty" yaml:"count,omitempty"`
+	Conditions  []string           `json:"conditions" yaml:"conditions"`
+	Groups      []groupDefinition  `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Salience    int                `json:"salience,omitempty" yaml:"salience,omitempty"`
+	Then        string             `json:"then" yaml:"then"`
+	Outcome     interface{}        `json:"outcome,omitempty" yaml:"outcome,omitempty"`
+	Actions     []actionDefinition `json:"actions,omitempty" yaml:"actions,omitempty"`
+}
+
+// actionDefinition declarative representation of a rule action: set, increment or append
+type actionDefinition struct {
+	Action string      `json:"action" yaml:"action"`
+	Fact   string      `json:"fact" yaml:"fact"`
+	Value  interface{} `json:"value" yaml:"value"`
+}
+
+// groupDefinition declarative representation of a nested group of conditions.
+// Count is the threshold of atleast, atmost and exactly groups.
+type groupDefinition struct {
+	When       string            `json:"when" yaml:"when"`
+	Count      int               `json:"count,omitempty" yaml:"count,omitempty"`
+	Conditions []string          `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+	Groups     []groupDefinition `json:"groups,omitempty" yaml:"groups,omitempty"`
+}
+
+// definitionError returns an ErrInvalidDefinition error with the given details
+func definitionError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidDefinition, fmt.Sprintf(format, args...))
+}
+
+// newConditionDefinition builds the declarative representation of the given condition
+func newConditionDefinition(c *_condition) conditionDefinition {
+	def := conditionDefinition{
+		Id:       fmt.Sprintf("c%d", c.id),
+		Term:     c.lTerm.token(),
+		Type:     c.lTerm.termKind().String(),
+		Operator: c.operator.String(),
+		Negated:  c.negated,
+	}
+
+	if c.rTerm.isVariable() {
+		def.Ref = c.rTerm.token()
+	} else {
+		def.Value = c.rTerm.val()
+	}
+
+	return def
+}
+
+// build creates the condition described by the definition
+func (def conditionDefinition) build() (*_condition, error) {
+	kind, ok := dslKinds[def.Type]
+	if !ok {
+		return nil, definitionError("condition %q has an unknown type %q", def.Id, def.Type)
+	}
+
+	op, ok := dslOperators[def.Operator]
+	if !ok || !kindSupportsOperator(kind, op) {
+		return nil, definitionError("condition %q has an unsupported %s operator %q", def.Id, kind, def.Operator)
+	}
+
+	object, attribute, ok := splitToken(def.Term)
+	if !ok {
+		return nil, definitionError("condition %q has a malformed term %q", def.Id, def.Term)
+	}
+
+	var right iTerm
+	if def.Ref != emptyStr {
+		rObject, rAttribute, ok := splitToken(def.Ref)
+		if !ok {
+			return nil, definitionError("condition %q has a malformed ref %q", def.Id, def.Ref)
+		}
+		right = newTypedVarTerm(rObject, rAttribute, kind)
+	} else {
+		value, err := definitionValue(kind, op, def.Value)
+		if err != nil {
+			return nil, definitionError("condition %q has an invalid %s value %v", def.Id, kind, def.Value)
+		}
+		right = newDiscreteTerm(value)
+	}
+
+	cb := newConditionBuilder().Left(newTypedVarTerm(object, attribute, kind)).Right(right).Operation(op)
+	if def.Negated {
+		cb.Not()
+	}
+	return cb.Build(), nil
+}
+
+// definitionTime formats the given time as RFC3339 keeping its sub-second precision, zero times are empty
+func definitionTime(t time.Time) string {
+	if t.IsZero() {
+		return emptyStr
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// definitionValue converts a decoded JSON or YAML value into the condition data type
+func definitionValue(kind tTerm, op tOperator, v interface{}) (interface{}, error) {
+	switch op {
+	case opIn:
+		values, ok := v.([]interface{})
+		if !ok {
+			return nil, ErrInvalidValueType
+		}
+		list := make([]string, len(values))
+		for i, item := range values {
+			if list[i], ok = item.(string); !ok {
+				return nil, ErrInvalidValueType
+			}
+		}
+		return list, nil
+	case opBetween:
+		values, ok := v.([]interface{})
+		if !ok || len(values) != 2 {
+			return nil, ErrInvalidValueType
+		}
+		list := make([]time.Time, len(values))
+		for i, item := range values {
+			d, err := definitionValue(termDate, opEquals, item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = d.(time.Time)
+		}
+		return list, nil
+	}
+
+	switch kind {
+	case termString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case termNumber:
+		switch n := v.(type) {
+		case json.Number:
+			return n.Int64()
+		case int:
+			return int64(n), nil
+		case int64:
+			return n, nil
+		}
+	case termFloat:
+		switch n := v.(type) {
+		case json.Number:
+			return n.Float64()
+		case float64:
+			return n, nil
+		case int:
+			return float64(n), nil
+		case int64:
+			return float64(n), nil
+		}
+	case termBoolean:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case termDate:
+		switch d := v.(type) {
+		case time.Time:
+			return d.UTC(), nil
+		case string:
+			return parseDate(d)
+		}
+	}
+
+	return nil, ErrInvalidValueType
+}
+
+// outcomeValue normalizes a decoded rule outcome replacing the JSON numbers by int64 or float64 values
+func outcomeValue(v interface{}) interface{} {
+	switch o := v.(type) {
+	case json.Number:
+		if n, err := o.Int64(); err == nil {
+			return n
+		}
+		f, _ := o.Float64()
+		return f
+	case int:
+		return int64(o)
+	case map[string]interface{}:
+		for k, item := range o {
+			o[k] = outcomeValue(item)
+		}
+	case []interface{}:
+		for i, item := range o {
+			o[i] = outcomeValue(item)
+		}
+	}
+	return v
+}
+
+// definition builds the declarative representation of the ruleset
+func (rs *_ruleset) definition() *rulesetDefinition {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	def := &rulesetDefinition{
+		Name:        rs.name,
+		Description: rs.description,
+		Conditions:  make([]conditionDefinition, 0, rs.lenc()),
+		Rules:       make([]ruleDefinition, 0, rs.lenr()),
+	}
+
+	for _, c := range rs.conditions {
+		if c != nil {
+			def.Conditions = append(def.Conditions, newConditionDefinition(c))
+		}
+	}
+
+	for _, r := range rs.rules {
+		if r == nil {
+			continue
+		}
+
+		gDef := newGroupDefinition(r.root())
+		def.Rules = append(def.Rules, ruleDefinition{
+			Id:          r.token,
+			Name:        r.name,
+			Description: r.description,
+			Owner:       r.owner,
+			Tags:        r.tags,
+			Disabled:    r.disabled,
+			From:        definitionTime(r.effectiveFrom),
+			Until:       definitionTime(r.effectiveUntil),
+			When:        gDef.When,
+			Count:       gDef.Count,
+			Conditions:  gDef.Conditions,
+			Groups:      gDef.Groups,
+			Salience:    r.salience,
+			Then:        r.then,
+			Outcome:     r.outcome,
+			Actions:     newActionDefinitions(r.actions),
+		})
+	}
+
+	return def
+}
+
+// newActionDefinitions builds the declarative representation of the given actions
+func newActionDefinitions(actions []_action) []actionDefinition {
+	defs := make([]actionDefinition, 0, len(actions))
+	for _, a := range actions {
+		value := a.value
+		if d, ok := value.(time.Time); ok {
+			value = definitionTime(d)
+		}
+		defs = append(defs, actionDefinition{Action: string(a.action), Fact: a.fact, Value: value})
+	}
+
+	if len(defs) == 0 {
+		return nil
+	}
+	return defs
+}
+
+// newGroupDefinition builds the declarative representation of the given group
+func newGroupDefinition(g *_group) groupDefinition {
+	def := groupDefinition{When: whenName(g.operator), Count: g.count, Conditions: make([]string, len(g.conditions))}
+	for i, c := range g.conditions {
+		def.Conditions[i] = fmt.Sprintf("c%d", c.id)
+	}
+	for _, sub := range g.groups {
+		def.Groups = append(def.Groups, newGroupDefinition(sub))
+	}
+	return def
+}
+
+// build creates the group described by the definition with the given declared conditions
+func (def groupDefinition) build(rule string, conditions map[string]conditionDefinition) (*_group, error) {
+	op, ok := whenOperators[def.When]
+	if !ok {
+		return nil, definitionError("rule %q has an unknown operator %q", rule, def.When)
+	}
+
+	expressions := make([]Expression, 0, len(def.Conditions)+len(def.Groups))
+	for _, id := range def.Conditions {
+		cDef, ok := conditions[id]
+		if !ok {
+			return nil, definitionError("rule %q references an unknown condition %q", rule, id)
+		}
+		// each rule owns its condition instances, the ruleset shares them by token
+		c, _ := cDef.build()
+		expressions = append(expressions, c)
+	}
+
+	for _, gDef := range def.Groups {
+		g, err := gDef.build(rule, conditions)
+		if err != nil {
+			return nil, err
+		}
+		expressions = append(expressions, g)
+	}
+
+	if op.isThreshold() {
+		return newThresholdGroup(op, def.Count, expressions...), nil
+	}
+	return newGroup(op, expressions...), nil
+}
+
+// load validates the whole definition and adds its rules into the ruleset.
+// The rules are checked against the ruleset and added holding its lock, so the definition is loaded whole or not at all.
+func (rs *_ruleset) load(def *rulesetDefinition) error {
+	conditions := make(map[string]conditionDefinition, len(def.Conditions))
+	for _, cDef := range def.Conditions {
+		if _, exists := conditions[cDef.Id]; exists {
+			return definitionError("condition %q is declared twice", cDef.Id)
+		}
+		// fail fast validating each condition once
+		if _, err := cDef.build(); err != nil {
+			return err
+		}
+		conditions[cDef.Id] = cDef
+	}
+
+	rules := make([]*_rule, 0, len(def.Rules))
+	ids := make(map[string]struct{}, len(def.Rules))
+	for _, rDef := range def.Rules {
+		gDef := groupDefinition{When: rDef.When, Count: rDef.Count, Conditions: rDef.Conditions, Groups: rDef.Groups}
+		g, err := gDef.build(rDef.Id, conditions)
+		if err != nil {
+			return err
+		}
+
+		rb := newRuleBuilder()
+		rb.group = g
+		rb.Id(rDef.Id).Name(rDef.Name).Description(rDef.Description).Owner(rDef.Owner).Tags(rDef.Tags...)
+		if rDef.Disabled {
+			rb.Disabled()
+		}
+		if rDef.From != emptyStr {
+			from, err := parseDate(rDef.From)
+			if err != nil {
+				return definitionError("rule %q has an invalid effective from %q", rDef.Id, rDef.From)
+			}
+			rb.EffectiveFrom(from)
+		}
+		if rDef.Until != emptyStr {
+			until, err := parseDate(rDef.Until)
+			if err != nil {
+				return definitionError("rule %q has an invalid effective until %q", rDef.Id, rDef.Until)
+			}
+			rb.EffectiveUntil(until)
+		}
+		for _, aDef := range rDef.Actions {
+			action, ok := actionTypes[aDef.Action]
+			if !ok {
+				return definitionError("rule %q has an unknown action %q", rDef.Id, aDef.Action)
+			}
+			rb.actions = append(rb.actions, newAction(action, aDef.Fact, outcomeValue(aDef.Value)))
+		}
+		r, err := rb.Salience(rDef.Salience).Then(rDef.Then).Outcome(outcomeValue(rDef.Outcome)).Build()
+		if err != nil {
+			return definitionError("rule %q: %s", rDef.Id, err)
+		}
+
+		if _, exists := ids[r.token]; exists {
+			return definitionError("rule %q: %s", r.token, ErrRuleAddedPreviously)
+		}
+		ids[r.token] = struct{}{}
+		rules = append(rules, r)
+	}
+
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	for _, r := range rules {
+		if _, exists := rs.ruleRef[r.token]; exists {
+			return definitionError("rule %q: %s", r.token, ErrRuleAddedPreviously)
+		}
+		if err := rs.schema.checkRule(r); err != nil {
+			return definitionError("rule %q: %s", r.token, err)
+		}
+	}
+
+	for _, r := range rules {
+		if err := rs.add(r); err != nil {
+			return err
+		}
+	}
+
+	if def.Name != emptyStr {
+		rs.name = def.Name
+	}
+	if def.Description != emptyStr {
+		rs.description = def.Description
+	}
+	return nil
+}
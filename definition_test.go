@@ -0,0 +1,203 @@
+package goldfish_re
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const yamlRuleset = `
+name: flyer awards
+description: User flyer gold award
+conditions:
+  - id: plan
+    term: User.plan
+    type: string
+    operator: "=="
+    value: gold
+  - id: miles
+    term: User.miles
+    type: number
+    operator: ">"
+    value: 3000
+  - id: status
+    term: User.status
+    type: string
+    operator: in
+    value: [active, referred, VIP]
+  - id: trip
+    term: Trip.miles
+    type: float
+    operator: ">="
+    ref: User.ratio
+    negated: true
+  - id: birthday
+    term: User.birthday
+    type: date
+    operator: between
+    value: ["1984-01-01T00:00:00Z", "1990-12-31T00:00:00Z"]
+  - id: active
+    term: User.active
+    type: boolean
+    operator: "=="
+    value: false
+rules:
+  - id: frequent flyer
+    when: all
+    conditions: [plan, miles]
+    then: ACTIVE_GOLD_AWARD
+    outcome:
+      discount: 15
+      ratio: 0.5
+      codes: [GOLD, FLYER]
+    actions:
+      - action: set
+        fact: User.status
+        value: VIP
+      - action: increment
+        fact: User.points
+        value: 10
+  - id: status update
+    when: any
+    conditions: [status, trip, birthday, active, plan]
+    then: ACTIVE_GOLD_AWARD_BY_STATUS_CHANGE
+  - id: nested
+    when: all
+    conditions: [plan]
+    groups:
+      - when: any
+        conditions: [miles, status]
+      - when: none
+        conditions: [active]
+    then: NESTED
+`
+
+func newTestRuleset() *ruleset {
+	return Builder().Ruleset().OnActivation(func(string, Context) {}).OnError(func(error) {}).Build()
+}
+
+// addTestRules parses the given source and adds its rules to the ruleset
+func addTestRules(t *testing.T, rs *ruleset, src string) {
+	rules, err := ParseRules(src)
+	assert.Nil(t, err)
+	for _, r := range rules {
+		assert.Nil(t, rs.AddRule(r))
+	}
+}
+
+// newTestContext adds the given rules to the ruleset and returns a new context with the facts registered on one object
+func newTestContext(t *testing.T, rs *ruleset, rules string, facts ...interface{}) *factContext {
+	addTestRules(t, rs, rules)
+
+	obj := &struct{}{}
+	ctx := rs.Context()
+	for _, f := range facts {
+		switch fact := f.(type) {
+		case String:
+			assert.Nil(t, ctx.RegisterString(obj, fact))
+		case Number:
+			assert.Nil(t, ctx.RegisterNumber(obj, fact))
+		case Float:
+			assert.Nil(t, ctx.RegisterFloat(obj, fact))
+		case Boolean:
+			assert.Nil(t, ctx.RegisterBoolean(obj, fact))
+		case Date:
+			assert.Nil(t, ctx.RegisterDate(obj, fact))
+		default:
+			assert.Fail(t, "invalid fact type")
+		}
+	}
+	return ctx
+}
+
+func Test_definition_roundTrip(t *testing.T) {
+	rs := newTestRuleset()
+	assert.Nil(t, rs.LoadYAML([]byte(yamlRuleset)))
+	assert.EqualValues(t, 3, rs.current().lenr())
+	assert.EqualValues(t, 6, rs.current().lenc())
+	assert.EqualValues(t, "&&(User.plan_==_gold,||(User.miles_>_3000,User.status_in_[active referred VIP]),!||(User.active_==_false))",
+		rs.current().ruleRef["nested"].group.token())
+	assert.EqualValues(t, "flyer awards", rs.current().name)
+	assert.EqualValues(t, map[string]interface{}{"discount": int64(15), "ratio": 0.5, "codes": []interface{}{"GOLD", "FLYER"}},
+		rs.current().ruleRef["frequent flyer"].outcome)
+	assert.EqualValues(t, []_action{{action: actionSet, fact: "User.status", value: "VIP"}, {action: actionIncrement, fact: "User.points", value: int64(10)}},
+		rs.current().ruleRef["frequent flyer"].actions)
+
+	jsonDoc, err := rs.ExportJSON()
+	assert.Nil(t, err)
+
+	fromJSON := newTestRuleset()
+	assert.Nil(t, fromJSON.LoadJSON(jsonDoc))
+	assert.EqualValues(t, rs.current().definition(), fromJSON.current().definition())
+
+	yamlDoc, err := fromJSON.ExportYAML()
+	assert.Nil(t, err)
+
+	fromYAML := newTestRuleset()
+	assert.Nil(t, fromYAML.LoadYAML(yamlDoc))
+	assert.EqualValues(t, rs.current().definition(), fromYAML.current().definition())
+
+	for cid, c := range rs.current().conditionRef {
+		assert.EqualValues(t, c.rTerm, fromYAML.current().conditionRef[cid].rTerm)
+	}
+}
+
+func Test_definition_invalid(t *testing.T) {
+	docs := []string{
+		`{"conditions": [], "rules": [{"when": "all", "conditions": ["c1"], "then": "X"}]}`,
+		`{"conditions": [{"id": "c1", "term": "User.plan", "type": "string", "operator": ">", "value": "gold"}], "rules": []}`,
+		`{"conditions": [{"id": "c1", "term": "User.miles", "type": "number", "operator": ">", "value": "gold"}], "rules": []}`,
+		`{"conditions": [{"id": "c1", "term": "User", "type": "number", "operator": ">", "value": 1}], "rules": []}`,
+		`{"conditions": [], "rules": [], "unknown": true}`,
+		`{"conditions": [{"id": "c1", "term": "User.plan", "type": "string", "operator": "==", "value": "gold"}], "rules": [{"when": "all", "conditions": ["c1"], "groups": [{"when": "some", "conditions": ["c1"]}], "then": "X"}]}`,
+	}
+
+	for _, doc := range docs {
+		rs := newTestRuleset()
+		err := rs.LoadJSON([]byte(doc))
+		assert.True(t, errors.Is(err, ErrInvalidDefinition), doc)
+		assert.EqualValues(t, 0, rs.current().lenr())
+	}
+}
+
+func Test_definition_loadWhole(t *testing.T) {
+	doc := `{"conditions": [{"id": "c1", "term": "User.plan", "type": "string", "operator": "==", "value": "gold"}],
+		"rules": [{"id": "a", "when": "all", "conditions": ["c1"], "then": "A"}, {"id": "b", "when": "all", "conditions": ["c1"], "then": "B"}]}`
+	c := Builder().StringCondition().Term("User", "plan").Equal("silver").Build()
+
+	// a rule added concurrently with the same identifier fails the whole document
+	for i := 0; i < 50; i++ {
+		rs := newTestRuleset()
+		r, err := Builder().Rule().Id("b").AllOf(c).Then("B").Build()
+		assert.Nil(t, err)
+
+		added := make(chan error)
+		go func() { added <- rs.AddRule(r) }()
+		err = rs.LoadJSON([]byte(doc))
+		if <-added == nil && err != nil {
+			assert.ErrorIs(t, err, ErrInvalidDefinition)
+			assert.EqualValues(t, 1, rs.current().lenr())
+		} else {
+			assert.Nil(t, err)
+			assert.EqualValues(t, 2, rs.current().lenr())
+		}
+	}
+}
+
+func Test_definition_subSecondWindow(t *testing.T) {
+	from := time.Date(2022, 11, 25, 10, 30, 0, 123456789, time.UTC)
+	c := Builder().StringCondition().Term("User", "plan").Equal("gold").Build()
+	r, err := Builder().Rule().Id("flash sale").EffectiveFrom(from).AllOf(c).Then("SALE").Build()
+	assert.Nil(t, err)
+
+	rs := newTestRuleset()
+	assert.Nil(t, rs.AddRule(r))
+	doc, err := rs.ExportJSON()
+	assert.Nil(t, err)
+
+	loaded := newTestRuleset()
+	assert.Nil(t, loaded.LoadJSON(doc))
+	assert.True(t, from.Equal(loaded.current().ruleRef["flash sale"].effectiveFrom))
+}
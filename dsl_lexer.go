@@ -0,0 +1,210 @@
+package goldfish_re
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tToken uint8
+
+const (
+	tokenEOF tToken = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenFloat
+	tokenOperator
+	tokenDot
+	tokenComma
+	tokenSemicolon
+	tokenLBrace
+	tokenRBrace
+	tokenLBracket
+	tokenRBracket
+	tokenInvalid
+)
+
+func (t tToken) String() string {
+	switch t {
+	case tokenEOF:
+		return "end of input"
+	case tokenIdent:
+		return "identifier"
+	case tokenString:
+		return "string"
+	case tokenNumber:
+		return "number"
+	case tokenFloat:
+		return "float"
+	case tokenOperator:
+		return "operator"
+	case tokenDot:
+		return "'.'"
+	case tokenComma:
+		return "','"
+	case tokenSemicolon:
+		return "';'"
+	case tokenLBrace:
+		return "'{'"
+	case tokenRBrace:
+		return "'}'"
+	case tokenLBracket:
+		return "'['"
+	case tokenRBracket:
+		return "']'"
+	default:
+		return "invalid token"
+	}
+}
+
+// token lexical unit with its position into the source
+type token struct {
+	kind   tToken
+	text   string
+	line   int
+	column int
+	err    string // lexical error of an invalid token
+}
+
+// lexer splits a rule source into tokens keeping track of line and column
+type lexer struct {
+	src    string
+	pos    int
+	line   int
+	column int
+}
+
+// newLexer lexer constructor
+func newLexer(src string) *lexer {
+	return &lexer{src: src, line: 1, column: 1}
+}
+
+// peek returns the next rune without consuming it
+func (l *lexer) peek() rune {
+	if l.pos >= len(l.src) {
+		return utf8.RuneError
+	}
+	r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+	return r
+}
+
+// peekAt returns the rune placed n bytes after the current position
+func (l *lexer) peekAt(n int) byte {
+	if l.pos+n >= len(l.src) {
+		return 0
+	}
+	return l.src[l.pos+n]
+}
+
+// advance consumes the next rune updating the line and column counters
+func (l *lexer) advance() rune {
+	r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+	l.pos += size
+	if r == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+	return r
+}
+
+// skip consumes whitespaces and comments (# and //) until the next token
+func (l *lexer) skip() {
+	for l.pos < len(l.src) {
+		r := l.peek()
+		switch {
+		case unicode.IsSpace(r):
+			l.advance()
+		case r == '#' || (r == '/' && l.peekAt(1) == '/'):
+			for l.pos < len(l.src) && l.peek() != '\n' {
+				l.advance()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// next returns the next token from the source
+func (l *lexer) next() token {
+	l.skip()
+
+	tkn := token{line: l.line, column: l.column}
+	if l.pos >= len(l.src) {
+		tkn.kind = tokenEOF
+		return tkn
+	}
+
+	start := l.pos
+	r := l.advance()
+	switch {
+	case r == '"':
+		tkn.kind = tokenString
+		for {
+			if l.pos >= len(l.src) || l.peek() == '\n' {
+				tkn.kind = tokenInvalid
+				tkn.err = "unterminated string"
+				break
+			}
+			c := l.advance()
+			if c == '\\' && l.pos < len(l.src) {
+				l.advance()
+				continue
+			}
+			if c == '"' {
+				break
+			}
+		}
+	case unicode.IsDigit(r) || (r == '-' && unicode.IsDigit(l.peek())):
+		tkn.kind = tokenNumber
+		for l.pos < len(l.src) {
+			c := l.peek()
+			if unicode.IsDigit(c) {
+				l.advance()
+			} else if c == '.' && tkn.kind == tokenNumber && unicode.IsDigit(rune(l.peekAt(1))) {
+				tkn.kind = tokenFloat
+				l.advance()
+			} else {
+				break
+			}
+		}
+	case unicode.IsLetter(r) || r == '_':
+		tkn.kind = tokenIdent
+		for l.pos < len(l.src) && (unicode.IsLetter(l.peek()) || unicode.IsDigit(l.peek()) || l.peek() == '_') {
+			l.advance()
+		}
+	case r == '=' || r == '!' || r == '<' || r == '>':
+		tkn.kind = tokenOperator
+		if l.peek() == '=' {
+			l.advance()
+		} else if r == '=' {
+			tkn.kind = tokenInvalid
+		}
+	case r == '.':
+		tkn.kind = tokenDot
+	case r == ',':
+		tkn.kind = tokenComma
+	case r == ';':
+		tkn.kind = tokenSemicolon
+	case r == '{':
+		tkn.kind = tokenLBrace
+	case r == '}':
+		tkn.kind = tokenRBrace
+	case r == '[':
+		tkn.kind = tokenLBracket
+	case r == ']':
+		tkn.kind = tokenRBracket
+	default:
+		tkn.kind = tokenInvalid
+	}
+
+	tkn.text = l.src[start:l.pos]
+	return tkn
+}
+
+// isKeyword checks if the token is the given identifier keyword (case-insensitive)
+func (t token) isKeyword(keyword string) bool {
+	return t.kind == tokenIdent && strings.EqualFold(t.text, keyword)
+}
@@ -0,0 +1,515 @@
+package goldfish_re
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dslOperators operators available into the rule language
+var dslOperators = map[string]tOperator{
+	"==":       opEquals,
+	">":        opGreaterThan,
+	">=":       opGreaterThanOrEqual,
+	"<":        opLessThan,
+	"<=":       opLessThanOrEqual,
+	"starts":   opStarts,
+	"ends":     opEnds,
+	"contains": opContains,
+	"in":       opIn,
+	"after":    opAfter,
+	"before":   opBefore,
+	"between":  opBetween,
+}
+
+// dslKinds data type keywords used to declare the condition type when it cannot be inferred
+var dslKinds = map[string]tTerm{
+	"string":  termString,
+	"number":  termNumber,
+	"float":   termFloat,
+	"boolean": termBoolean,
+	"date":    termDate,
+}
+
+// dslKindOperators supported operators by data type
+var dslKindOperators = map[tTerm][]tOperator{
+	termString:  {opEquals, opStarts, opEnds, opContains, opIn},
+	termNumber:  {opEquals, opGreaterThan, opGreaterThanOrEqual, opLessThan, opLessThanOrEqual},
+	termFloat:   {opEquals, opGreaterThan, opGreaterThanOrEqual, opLessThan, opLessThanOrEqual},
+	termBoolean: {opEquals},
+	termDate:    {opEquals, opAfter, opBefore, opBetween},
+}
+
+// parser rule language parser.
+//
+//	rules     := rule*
+//	rule      := 'rule' STRING ['salience' NUMBER] 'when' group 'then' STRING [actions]
+//	actions   := '{' action ([';' | ','] action)* '}'
+//	action    := ('set' | 'increment' | 'append') term literal
+//	group     := ('all' | 'any' | 'none' | ('atleast' | 'atmost' | 'exactly') NUMBER) '{' item ([';' | ','] item)* '}'
+//	item      := group | condition
+//	condition := ['not'] [kind] term operator operand
+//	term      := IDENT '.' IDENT
+//	operand   := STRING | NUMBER | FLOAT | 'true' | 'false' | '[' literal (',' literal)* ']' | term
+type parser struct {
+	lex  *lexer
+	tkn  token
+	next token
+}
+
+// newParser parser constructor
+func newParser(src string) *parser {
+	p := &parser{lex: newLexer(src)}
+	p.tkn = p.lex.next()
+	p.next = p.lex.next()
+	return p
+}
+
+// errorf returns a ParseError positioned at the given token, or the lexical error of a pending invalid token
+func (p *parser) errorf(tkn token, format string, args ...interface{}) error {
+	for _, t := range []token{tkn, p.tkn, p.next} {
+		if t.err != emptyStr {
+			return &ParseError{Line: t.line, Column: t.column, Token: t.text, Msg: t.err}
+		}
+	}
+	return &ParseError{Line: tkn.line, Column: tkn.column, Token: tkn.text, Msg: fmt.Sprintf(format, args...)}
+}
+
+// consume returns the current token and moves forward
+func (p *parser) consume() token {
+	tkn := p.tkn
+	p.tkn = p.next
+	p.next = p.lex.next()
+	return tkn
+}
+
+// expect consumes the current token if it is of the given kind or fails
+func (p *parser) expect(kind tToken) (token, error) {
+	if p.tkn.kind != kind {
+		return p.tkn, p.errorf(p.tkn, "expected %s but found %s", kind, p.tkn.kind)
+	}
+	return p.consume(), nil
+}
+
+// expectKeyword consumes the current token if it is the given keyword or fails
+func (p *parser) expectKeyword(keyword string) (token, error) {
+	if !p.tkn.isKeyword(keyword) {
+		return p.tkn, p.errorf(p.tkn, "expected '%s' but found %s", keyword, p.tkn.kind)
+	}
+	return p.consume(), nil
+}
+
+// parseRules parses all rules until the end of the source
+func (p *parser) parseRules() ([]*_rule, error) {
+	rules := make([]*_rule, 0)
+	for p.tkn.kind != tokenEOF {
+		r, err := p.parseRule()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// parseRule parses a single rule definition
+func (p *parser) parseRule() (*_rule, error) {
+	start, err := p.expectKeyword("rule")
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := p.parseString()
+	if err != nil {
+		return nil, err
+	}
+
+	salience := 0
+	if p.tkn.isKeyword("salience") {
+		p.consume()
+		tkn, err := p.expect(tokenNumber)
+		if err != nil {
+			return nil, err
+		}
+		if salience, err = strconv.Atoi(tkn.text); err != nil {
+			return nil, p.errorf(tkn, "invalid salience")
+		}
+	}
+
+	if _, err := p.expectKeyword("when"); err != nil {
+		return nil, err
+	}
+
+	group, err := p.parseGroup()
+	if err != nil {
+		return nil, err
+	}
+
+	thenTkn, err := p.expectKeyword("then")
+	if err != nil {
+		return nil, err
+	}
+
+	then, err := p.parseString()
+	if err != nil {
+		return nil, err
+	}
+
+	rb := newRuleBuilder()
+	rb.group = group
+	if p.tkn.kind == tokenLBrace {
+		if rb.actions, err = p.parseActions(); err != nil {
+			return nil, err
+		}
+	}
+
+	r, err := rb.Id(name).Name(name).Salience(salience).Then(then).Build()
+	if errors.Is(err, ErrEmptyThenSentence) {
+		return nil, p.errorf(thenTkn, "invalid rule %q: %s", name, err)
+	} else if err != nil {
+		return nil, p.errorf(start, "invalid rule %q: %s", name, err)
+	}
+
+	return r, nil
+}
+
+// parseActions parses the rule actions between braces. The data type of each value is inferred by its literal
+func (p *parser) parseActions() ([]_action, error) {
+	p.consume()
+
+	actions := make([]_action, 0)
+	for p.tkn.kind != tokenRBrace {
+		start := p.tkn
+		action, ok := actionTypes[strings.ToLower(p.tkn.text)]
+		if !ok || p.tkn.kind != tokenIdent {
+			return nil, p.errorf(p.tkn, "expected 'set', 'increment' or 'append' but found %s", p.tkn.kind)
+		}
+		p.consume()
+
+		object, attribute, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+
+		kind := p.literalKind()
+		if kind == termInvalid {
+			return nil, p.errorf(p.tkn, "expected a value but found %s", p.tkn.kind)
+		}
+
+		value, err := p.parseLiteral(kind)
+		if err != nil {
+			return nil, err
+		}
+		a := newAction(action, object+"."+attribute, value)
+		if err := a.validate(); err != nil {
+			return nil, p.errorf(start, "invalid action: %s", err)
+		}
+		actions = append(actions, a)
+
+		// actions can be split by line breaks or separators
+		if p.tkn.kind == tokenSemicolon || p.tkn.kind == tokenComma {
+			p.consume()
+		}
+	}
+	p.consume()
+
+	return actions, nil
+}
+
+// parseGroup parses a group operator followed by its conditions and nested groups between braces.
+// The group is validated here so the error points at its operator instead of the rule.
+func (p *parser) parseGroup() (*_group, error) {
+	start := p.tkn
+	op, ok := whenOperators[strings.ToLower(p.tkn.text)]
+	if !ok || p.tkn.kind != tokenIdent {
+		return nil, p.errorf(p.tkn, "expected 'all', 'any', 'none', 'atleast', 'atmost' or 'exactly' but found %s", p.tkn.kind)
+	}
+	p.consume()
+
+	count := 0
+	if op.isThreshold() {
+		tkn, err := p.expect(tokenNumber)
+		if err != nil {
+			return nil, err
+		}
+		if count, err = strconv.Atoi(tkn.text); err != nil {
+			return nil, p.errorf(tkn, "invalid threshold")
+		}
+	}
+
+	if _, err := p.expect(tokenLBrace); err != nil {
+		return nil, err
+	}
+
+	expressions := make([]Expression, 0)
+	for p.tkn.kind != tokenRBrace {
+		if p.isGroup() {
+			g, err := p.parseGroup()
+			if err != nil {
+				return nil, err
+			}
+			expressions = append(expressions, g)
+		} else {
+			c, err := p.parseCondition()
+			if err != nil {
+				return nil, err
+			}
+			expressions = append(expressions, c)
+		}
+
+		// conditions can be split by line breaks or separators
+		if p.tkn.kind == tokenSemicolon || p.tkn.kind == tokenComma {
+			p.consume()
+		}
+	}
+	p.consume()
+
+	g := newGroup(op, expressions...)
+	if op.isThreshold() {
+		g = newThresholdGroup(op, count, expressions...)
+	}
+
+	if err := g.validate(); err != nil {
+		return nil, p.errorf(start, "invalid group: %s", err)
+	}
+	return g, nil
+}
+
+// isGroup checks if the current token starts a nested group instead of a condition
+func (p *parser) isGroup() bool {
+	op, ok := whenOperators[strings.ToLower(p.tkn.text)]
+	if !ok || p.tkn.kind != tokenIdent {
+		return false
+	}
+
+	if op.isThreshold() {
+		return p.next.kind == tokenNumber
+	}
+	return p.next.kind == tokenLBrace
+}
+
+// parseCondition parses a single condition
+func (p *parser) parseCondition() (*_condition, error) {
+	cb := newConditionBuilder()
+
+	if p.tkn.isKeyword("not") {
+		p.consume()
+		cb.Not()
+	}
+
+	kind := termInvalid
+	if k, ok := dslKinds[strings.ToLower(p.tkn.text)]; ok && p.tkn.kind == tokenIdent && p.next.kind == tokenIdent {
+		kind = k
+		p.consume()
+	}
+
+	leftTkn := p.tkn
+	object, attribute, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	opTkn := p.tkn
+	var op tOperator
+	if opTkn.text == "!=" {
+		op = opEquals
+		cb.negated = !cb.negated
+	} else if o, ok := dslOperators[strings.ToLower(opTkn.text)]; ok && (opTkn.kind == tokenOperator || opTkn.kind == tokenIdent) {
+		op = o
+	} else {
+		return nil, p.errorf(opTkn, "expected a condition operator but found %s", opTkn.kind)
+	}
+	p.consume()
+
+	// the data type is inferred by the operator or the right term when it is not declared
+	if kind == termInvalid {
+		switch op {
+		case opStarts, opEnds, opContains, opIn:
+			kind = termString
+		case opAfter, opBefore, opBetween:
+			kind = termDate
+		default:
+			kind = p.literalKind()
+		}
+	}
+
+	if kind == termInvalid {
+		return nil, p.errorf(leftTkn, "cannot infer the data type of %s.%s, declare it as string, number, float, boolean or date", object, attribute)
+	}
+
+	if !kindSupportsOperator(kind, op) {
+		return nil, p.errorf(opTkn, "operator '%s' is not supported by %s conditions", op, kind)
+	}
+
+	right, err := p.parseOperand(kind, op)
+	if err != nil {
+		return nil, err
+	}
+
+	c := cb.Left(newTypedVarTerm(object, attribute, kind)).Right(right).Operation(op).Build()
+	if err := _schema(nil).checkCondition(c); err != nil {
+		return nil, p.errorf(leftTkn, "invalid condition: %s", err)
+	}
+	return c, nil
+}
+
+// parseTerm parses an object attribute reference like User.plan
+func (p *parser) parseTerm() (string, string, error) {
+	object, err := p.expect(tokenIdent)
+	if err != nil {
+		return emptyStr, emptyStr, err
+	}
+
+	if _, err := p.expect(tokenDot); err != nil {
+		return emptyStr, emptyStr, err
+	}
+
+	attribute, err := p.expect(tokenIdent)
+	if err != nil {
+		return emptyStr, emptyStr, err
+	}
+
+	return object.text, attribute.text, nil
+}
+
+// literalKind returns the data type of the current literal token
+func (p *parser) literalKind() tTerm {
+	switch {
+	case p.tkn.kind == tokenString:
+		return termString
+	case p.tkn.kind == tokenNumber:
+		return termNumber
+	case p.tkn.kind == tokenFloat:
+		return termFloat
+	case p.tkn.isKeyword("true"), p.tkn.isKeyword("false"):
+		return termBoolean
+	default:
+		return termInvalid
+	}
+}
+
+// parseOperand parses the right condition term for the given data type and operator
+func (p *parser) parseOperand(kind tTerm, op tOperator) (iTerm, error) {
+
+	// right term as fact reference
+	if p.tkn.kind == tokenIdent && !p.tkn.isKeyword("true") && !p.tkn.isKeyword("false") {
+		if op == opIn || op == opBetween {
+			return nil, p.errorf(p.tkn, "operator '%s' expects a list of values", op)
+		}
+
+		object, attribute, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		return newTypedVarTerm(object, attribute, kind), nil
+	}
+
+	// right term as list of values
+	if op == opIn || op == opBetween {
+		if _, err := p.expect(tokenLBracket); err != nil {
+			return nil, err
+		}
+
+		values := make([]interface{}, 0)
+		for p.tkn.kind != tokenRBracket {
+			v, err := p.parseLiteral(kind)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+
+			if p.tkn.kind == tokenComma {
+				p.consume()
+			} else if p.tkn.kind != tokenRBracket {
+				return nil, p.errorf(p.tkn, "expected ',' or ']' but found %s", p.tkn.kind)
+			}
+		}
+		end := p.consume()
+
+		if op == opIn {
+			list := make([]string, len(values))
+			for i, v := range values {
+				list[i] = v.(string)
+			}
+			return newStringListTerm(list), nil
+		}
+
+		if len(values) != 2 {
+			return nil, p.errorf(end, "operator 'between' expects two dates but found %d", len(values))
+		}
+		return newDateListTerm([]time.Time{values[0].(time.Time), values[1].(time.Time)}), nil
+	}
+
+	v, err := p.parseLiteral(kind)
+	if err != nil {
+		return nil, err
+	}
+	return newDiscreteTerm(v), nil
+}
+
+// parseLiteral parses a discrete value of the given data type
+func (p *parser) parseLiteral(kind tTerm) (interface{}, error) {
+	tkn := p.tkn
+	switch kind {
+	case termString:
+		return p.parseString()
+	case termNumber:
+		if tkn.kind == tokenNumber {
+			if n, err := strconv.ParseInt(tkn.text, 10, 64); err == nil {
+				p.consume()
+				return n, nil
+			}
+		}
+	case termFloat:
+		if tkn.kind == tokenNumber || tkn.kind == tokenFloat {
+			if n, err := strconv.ParseFloat(tkn.text, 64); err == nil {
+				p.consume()
+				return n, nil
+			}
+		}
+	case termBoolean:
+		if tkn.isKeyword("true") || tkn.isKeyword("false") {
+			p.consume()
+			return strings.EqualFold(tkn.text, "true"), nil
+		}
+	case termDate:
+		if tkn.kind == tokenString {
+			s, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			if d, err := parseDate(s); err == nil {
+				return d, nil
+			}
+			return nil, p.errorf(tkn, "invalid date, expected format 2006-01-02T15:04:05")
+		}
+	}
+
+	return nil, p.errorf(tkn, "expected a %s value but found %s", kind, tkn.kind)
+}
+
+// parseString parses a quoted string literal
+func (p *parser) parseString() (string, error) {
+	tkn, err := p.expect(tokenString)
+	if err != nil {
+		return emptyStr, err
+	}
+
+	s, err := strconv.Unquote(tkn.text)
+	if err != nil {
+		return emptyStr, p.errorf(tkn, "malformed string")
+	}
+	return s, nil
+}
+
+// kindSupportsOperator checks if the given operator can be applied over the data type
+func kindSupportsOperator(kind tTerm, op tOperator) bool {
+	for _, o := range dslKindOperators[kind] {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package goldfish_re
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_dsl_parseRule(t *testing.T) {
+	src := `rule "frequent flyer" when all { User.plan == "gold"; User.miles > 3000 } then "ACTIVE_GOLD_AWARD"`
+
+	r, err := ParseRule(src)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "frequent flyer", r.token)
+	assert.EqualValues(t, opAnd, r.operator)
+	assert.EqualValues(t, "ACTIVE_GOLD_AWARD", r.then)
+	assert.EqualValues(t, "frequent flyer", r.name)
+	assert.Len(t, r.conditions, 2)
+
+	c1 := Builder().StringCondition().Term("User", "plan").Equal("gold").Build()
+	c2 := Builder().NumberCondition().Term("User", "miles").GreaterThan(3000).Build()
+	expected, _ := Builder().Rule().AllOf(c1, c2).Then("ACTIVE_GOLD_AWARD").Build()
+
+	for id, c := range expected.conditions {
+		assert.EqualValues(t, c.token(), r.conditions[id].token())
+		assert.EqualValues(t, c.lTerm, r.conditions[id].lTerm)
+		assert.EqualValues(t, c.rTerm, r.conditions[id].rTerm)
+	}
+}
+
+func Test_dsl_parseRules(t *testing.T) {
+	src := `
+	# flight award program
+	rule "status" when any {
+		User.status in ["active", "referred", "VIP"]
+		not User.plan starts "sil";
+		number Trip.miles > User.miles,
+		User.birthday between ["1984-01-01", "1990-12-31T00:00:00"]
+		User.active != true
+		User.nanos >= 12.5
+	} then "ACTIVE_GOLD_AWARD_BY_STATUS_CHANGE"
+
+	rule "dates" when all { Date.day after "2022-10-01" } then "DATES"
+	`
+
+	rules, err := ParseRules(src)
+	assert.Nil(t, err)
+	assert.Len(t, rules, 2)
+	assert.EqualValues(t, opOr, rules[0].operator)
+
+	tokens := []string{}
+	for _, c := range rules[0].conditions {
+		tokens = append(tokens, c.token())
+	}
+	assert.Contains(t, tokens, "User.status_in_[active referred VIP]")
+	assert.Contains(t, tokens, "!User.plan_starts_sil")
+	assert.Contains(t, tokens, "Trip.miles_>_User.miles")
+	assert.Contains(t, tokens, "!User.active_==_true")
+	assert.Contains(t, tokens, "User.nanos_>=_12.5")
+	assert.EqualValues(t, "Date.day", rules[1].conditions[0].lTerm.token())
+}
+
+func Test_dsl_parseError(t *testing.T) {
+	cases := []struct {
+		src    string
+		line   int
+		column int
+		token  string
+	}{
+		{`rule "r1" when all { User.plan == "gold" } than "X"`, 1, 44, "than"},
+		{"rule \"r1\" when all {\n  User.miles > \"gold\"\n} then \"X\"", 2, 14, ">"},
+		{"rule \"r1\" when all {\n  User.plan starts 10 } then \"X\"", 2, 20, "10"},
+		{`rule "r1" when all { User.miles > Trip.miles } then "X"`, 1, 22, "User"},
+		{`rule "r1" when all { User.active > true } then "X"`, 1, 34, ">"},
+		{`rule "r1" when all { } then "X"`, 1, 16, "all"},
+		{"rule \"r1\" when all {\n  User.plan == \"gold\"\n  atleast 3 { User.miles > 10; User.age > 18 }\n} then \"X\"", 3, 3, "atleast"},
+		{"rule \"r1\" when all { User.plan == \"gold\" } then \"X\" {\n  increment User.plan \"gold\"\n}", 2, 3, "increment"},
+		{`rule "r1" when all { User.plan == "gold" } then "X" { remove User.plan "gold" }`, 1, 55, "remove"},
+	}
+
+	for _, tc := range cases {
+		_, err := ParseRules(tc.src)
+		var perr *ParseError
+		if assert.True(t, errors.As(err, &perr), tc.src) {
+			assert.EqualValues(t, tc.line, perr.Line, tc.src)
+			assert.EqualValues(t, tc.column, perr.Column, tc.src)
+			assert.EqualValues(t, tc.token, perr.Token, tc.src)
+		}
+	}
+}
+
+func Test_dsl_unterminatedString(t *testing.T) {
+	cases := []struct {
+		src    string
+		line   int
+		column int
+	}{
+		{"rule \"r1\" when all {\n  User.plan == \"gold\n} then \"X\"", 2, 16},
+		{"rule \"r1 when all {\n  User.plan == \"gold\"\n} then \"X\"", 1, 6},
+		{`rule "r1" when all { User.plan == "gold" } then "X`, 1, 49},
+	}
+
+	for _, tc := range cases {
+		_, err := ParseRules(tc.src)
+		var perr *ParseError
+		if assert.True(t, errors.As(err, &perr), tc.src) {
+			assert.EqualValues(t, tc.line, perr.Line, tc.src)
+			assert.EqualValues(t, tc.column, perr.Column, tc.src)
+			assert.EqualValues(t, "unterminated string", perr.Msg, tc.src)
+		}
+	}
+}
+
+func Test_dsl_emptyThen(t *testing.T) {
+	_, err := ParseRules(`rule "r1" when all { User.plan == "gold" } then ""`)
+
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.EqualValues(t, 1, perr.Line)
+		assert.EqualValues(t, 44, perr.Column)
+		assert.EqualValues(t, "then", perr.Token)
+	}
+}
+
+func Test_dsl_kindKeywordCase(t *testing.T) {
+	r, err := ParseRule(`rule "r1" when all { NUMBER Trip.miles > User.miles } then "X"`)
+	if assert.Nil(t, err) {
+		assert.EqualValues(t, "Trip.miles_>_User.miles", r.conditions[0].token())
+	}
+}
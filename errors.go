@@ -1,6 +1,10 @@
 package goldfish_re
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 // noErr is the same that a nil, only adds semantic
 var noErr error = nil
@@ -27,6 +31,12 @@ var (
 	// ErrEmptyThenSentence empty 'then' sentence in rule
 	ErrEmptyThenSentence = errors.New("empty 'then' sentence in rule")
 
+	// ErrInvalidThreshold the threshold must be between zero and the amount of expressions of the group
+	ErrInvalidThreshold = errors.New("invalid threshold, must be between zero and the amount of expressions")
+
+	// ErrInvalidEffectiveWindow the rule effective from time must be before its effective until time
+	ErrInvalidEffectiveWindow = errors.New("invalid effective window, from must be before until")
+
 	// ErrEmptyConditionList the rule must contains at least one condition
 	ErrEmptyConditionList = errors.New("the rule must contains at least one condition")
 
@@ -36,6 +46,166 @@ var (
 	// ErrFactNotFound fact not found
 	ErrFactNotFound = errors.New("fact not found")
 
+	// ErrMalformedFact the fact must be named as Object.attribute
+	ErrMalformedFact = errors.New("malformed fact, expected Object.attribute")
+
 	// ErrFactInvalidType fact is registered with different data type
 	ErrFactInvalidType = errors.New("fact is registered with different data type")
+
+	// ErrRuleAddedPreviously a rule with the same identifier was added previously
+	ErrRuleAddedPreviously = errors.New("rule added previously")
+
+	// ErrRuleNotFound rule not found
+	ErrRuleNotFound = errors.New("rule not found")
+
+	// ErrInvalidRulesetVersion the ruleset version to swap must be created by the Builder or NewVersion
+	ErrInvalidRulesetVersion = errors.New("invalid ruleset version")
+
+	// ErrRulesetSwapped the ruleset was published by Swap into another one, so it is read-only
+	ErrRulesetSwapped = errors.New("ruleset version already swapped")
+
+	// ErrInvalidDefinition invalid ruleset definition
+	ErrInvalidDefinition = errors.New("invalid ruleset definition")
+
+	// ErrSchemaMismatch the fact data type doesn't match the declared schema
+	ErrSchemaMismatch = errors.New("fact data type doesn't match the schema")
+
+	// ErrIncompatibleTerms the condition terms have different data types
+	ErrIncompatibleTerms = errors.New("condition terms have incompatible data types")
+
+	// ErrHitPolicyViolation the matched rules violate the ruleset hit policy
+	ErrHitPolicyViolation = errors.New("hit policy violation")
+
+	// ErrActivationRecovered recovered activation handler after panic.
+	// It wraps ErrContextUpdateRecovered, returned by the update when the handler panicked.
+	ErrActivationRecovered = fmt.Errorf("%w in the activation handler", ErrContextUpdateRecovered)
+
+	// ErrInvalidAction the rule action cannot be applied over the target fact data type
+	ErrInvalidAction = errors.New("invalid rule action")
+
+	// ErrFeedbackConflict a feedback transaction sets a fact already set with other value by a previous feedback of the same evaluation
+	ErrFeedbackConflict = errors.New("conflicting feedback transactions")
+
+	// ErrReentrantUpdate the context was updated from its own activation handler while it was being evaluated
+	ErrReentrantUpdate = errors.New("re-entrant context update")
+
+	// ErrMaxIterationsReached the feedback iterations limit was reached before the context became stable
+	ErrMaxIterationsReached = errors.New("max feedback iterations reached")
 )
+
+// ParseError rule source parsing error with the position of the offending token
+type ParseError struct {
+	Line   int
+	Column int
+	Token  string
+	Msg    string
+}
+
+// Error returns the error message including the line and column where the parsing failed
+func (e *ParseError) Error() string {
+	if e.Token == emptyStr {
+		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+	}
+	return fmt.Sprintf("line %d, column %d: %s near %q", e.Line, e.Column, e.Msg, e.Token)
+}
+
+// EvalError ruleset evaluation error sent to the OnError handler.
+// Rule, Condition and Fact are filled when they are known at the point of failure.
+type EvalError struct {
+	Rule      string
+	RuleName  string
+	Condition string
+	Fact      string
+	Cause     error
+}
+
+// Error returns the error message including the evaluation details
+func (e *EvalError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("evaluation error")
+	if e.Rule != emptyStr {
+		sb.WriteString(fmt.Sprintf(" rule %q", e.Rule))
+	}
+	if e.RuleName != emptyStr {
+		sb.WriteString(fmt.Sprintf(" (%s)", e.RuleName))
+	}
+	if e.Condition != emptyStr {
+		sb.WriteString(fmt.Sprintf(" condition %q", e.Condition))
+	}
+	if e.Fact != emptyStr {
+		sb.WriteString(fmt.Sprintf(" fact %q", e.Fact))
+	}
+	sb.WriteString(fmt.Sprintf(": %s", e.Cause))
+	return sb.String()
+}
+
+// Unwrap returns the error cause
+func (e *EvalError) Unwrap() error {
+	return e.Cause
+}
+
+// CoalescedError errors of the updates coalesced into a single evaluation
+type CoalescedError struct {
+	Errors []error
+}
+
+// newCoalescedError returns the given errors as a *CoalescedError or nil if there are not errors
+func newCoalescedError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &CoalescedError{Errors: errs}
+}
+
+// Error returns the message of each one of the errors
+func (e *CoalescedError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d coalesced update errors: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Is checks if any of the errors matches the target
+func (e *CoalescedError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error that matches the target
+func (e *CoalescedError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// CycleError feedback loop diagnostics returned by an update that reached the max iterations.
+// It wraps ErrMaxIterationsReached.
+type CycleError struct {
+	// Iterations identifiers of the rules fired by each iteration, the first one is the update itself
+	Iterations [][]string
+	// Oscillating facts that returned to a previous value during the update
+	Oscillating []string
+}
+
+// Error returns the error message including the oscillating facts.
+// The reported iterations are the feedback ones, without the update itself.
+func (e *CycleError) Error() string {
+	msg := fmt.Sprintf("%s after %d iterations", ErrMaxIterationsReached, len(e.Iterations)-1)
+	if len(e.Oscillating) > 0 {
+		msg += fmt.Sprintf(", oscillating facts %v", e.Oscillating)
+	}
+	return msg
+}
+
+// Unwrap returns ErrMaxIterationsReached
+func (e *CycleError) Unwrap() error {
+	return ErrMaxIterationsReached
+}
@@ -0,0 +1,116 @@
+package goldfish_re
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_errors_onError(t *testing.T) {
+	errs := make([]error, 0)
+	plan := NewString("User", "plan", "bronze")
+	rs := Builder().Ruleset().
+		OnActivation(func(then string, ctx Context) {
+			switch then {
+			case "PANIC":
+				panic("boom")
+			case "SILVER":
+				ctx.Feedback(func(tx *Tx) { tx.SetString(plan, "platinum") })
+			case "PLATINUM":
+				ctx.Feedback(func(tx *Tx) { tx.SetString(plan, "silver") })
+			}
+		}).
+		OnError(func(err error) { errs = append(errs, err) }).
+		Build()
+
+	ctx := newTestContext(t, rs, `
+		rule "miles" when all { User.miles == 3000 } then "MILES"
+		rule "panic" when all { User.plan == "gold" } then "PANIC"
+		rule "silver" when all { User.plan == "silver" } then "SILVER"
+		rule "platinum" when all { User.plan == "platinum" } then "PLATINUM"
+	`, plan, NewString("User", "miles", "many"))
+
+	// fact runtime type doesn't match the condition data type
+	assert.Nil(t, ctx.Update(func(tx *Tx) {}))
+	var evalErr *EvalError
+	if assert.Len(t, errs, 1) && assert.True(t, errors.As(errs[0], &evalErr)) {
+		assert.EqualValues(t, "miles", evalErr.Rule)
+		assert.EqualValues(t, "User.miles_==_3000", evalErr.Condition)
+		assert.EqualValues(t, "User.miles", evalErr.Fact)
+		assert.ErrorIs(t, evalErr, ErrInvalidValueType)
+	}
+
+	// recovered activation handler panic
+	errs = errs[:0]
+	err := ctx.SetString(plan, "gold")
+	assert.ErrorIs(t, err, ErrActivationRecovered)
+	assert.ErrorIs(t, err, ErrContextUpdateRecovered)
+	if assert.Len(t, errs, 1) && assert.True(t, errors.As(errs[0], &evalErr)) {
+		assert.EqualValues(t, "panic", evalErr.Rule)
+		assert.ErrorIs(t, evalErr, ErrActivationRecovered)
+	}
+
+	// exceeded feedback iterations
+	errs = errs[:0]
+	ctx.WithMaxIterations(3)
+	err = ctx.SetString(plan, "silver")
+	assert.ErrorIs(t, err, ErrMaxIterationsReached)
+	var cycleErr *CycleError
+	if assert.True(t, errors.As(err, &cycleErr)) {
+		assert.EqualValues(t, [][]string{{"silver"}, {"platinum"}, {"silver"}, {"platinum"}}, cycleErr.Iterations)
+		assert.EqualValues(t, []string{"User.plan"}, cycleErr.Oscillating)
+	}
+	if assert.Len(t, errs, 1) {
+		assert.ErrorIs(t, errs[0], ErrMaxIterationsReached)
+	}
+
+	// transaction error
+	errs = errs[:0]
+	err = ctx.Update(func(tx *Tx) { tx.preset(plan, int64(1)) })
+	assert.ErrorIs(t, err, ErrInvalidValueType)
+	if assert.Len(t, errs, 1) && assert.True(t, errors.As(errs[0], &evalErr)) {
+		assert.EqualValues(t, "User.plan", evalErr.Fact)
+		assert.ErrorIs(t, evalErr, ErrInvalidValueType)
+	}
+}
+
+func Test_errors_onErrorReentrant(t *testing.T) {
+	var rs *ruleset
+	var other *factContext
+	var evaluated []Activation
+	status := NewString("User", "status", "active")
+	rs = Builder().Ruleset().
+		OnActivation(func(then string, _ Context) {
+			if then == "PANIC" {
+				panic("boom")
+			}
+		}).
+		OnError(func(err error) {
+			if errors.Is(err, ErrActivationRecovered) {
+				evaluated, _ = rs.Evaluate(map[string]interface{}{"User.status": "VIP"})
+				_ = other.SetString(status, "VIP")
+			}
+		}).
+		Build()
+
+	plan := NewString("User", "plan", "silver")
+	ctx := newTestContext(t, rs, `
+		rule "panic" when all { User.plan == "gold" } then "PANIC"
+		rule "vip" when all { User.status == "VIP" } then "VIP"
+	`, plan)
+	other = newTestContext(t, rs, emptyStr, status)
+
+	// the error handler evaluates the ruleset and updates another context
+	done := make(chan error)
+	go func() { done <- ctx.SetString(plan, "gold") }()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, ErrActivationRecovered)
+	case <-time.After(time.Second):
+		assert.FailNow(t, "the error handler deadlocked")
+	}
+	assert.EqualValues(t, []string{"VIP"}, activationThens(evaluated))
+	assert.EqualValues(t, "VIP", status.Value())
+}
@@ -48,11 +48,11 @@ func createRuleset() (gre.Ruleset, error) {
 			if obj, ok := context.GetObject("User"); ok {
 				fmt.Println("-- context.GetObject(User).Email()=", obj.(*User).Email())
 
-				// fatal error: all goroutines are asleep - deadlock!
-				// the User).SetMiles() has a reference to the same context that triggered the previous update.
-				// To cover this use case please see the previous Feedback function.
+				// User.SetMiles() has a reference to the same context that triggered the previous update,
+				// so the update is deferred as a feedback transaction (or rejected with gre.ErrReentrantUpdate
+				// when the context is created WithReentrancy(gre.RejectReentrant)).
 				//if err := obj.(*User).SetMiles(5000); err != nil {
-				//	fmt.Println("**** DEADLOCK!", err)
+				//	fmt.Println("**** RE-ENTRANT UPDATE!", err)
 				//}
 			}
 		}).
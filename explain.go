@@ -0,0 +1,85 @@
+package goldfish_re
+
+import "github.com/kelindar/bitmap"
+
+// explain reports how each condition of the given rule was evaluated with the given facts.
+// The conditions are evaluated without the alpha index, so the facts can be a snapshot not kept into it.
+func (rs *_ruleset) explain(token string, ctx _factContext) (*Explanation, error) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	r, exists := rs.ruleRef[token]
+	if !exists {
+		return nil, ErrRuleNotFound
+	}
+
+	activatedBm, _, _ := rs.activateWithoutIndex(ctx)
+
+	e := &Explanation{Rule: r.token, Name: r.name, Then: r.then, Operator: r.root().when(), Disabled: r.disabled}
+	e.Effective = r.effective(rs.now())
+	e.Activated = !r.disabled && e.Effective && r.match(activatedBm)
+
+	blocking := map[cuid]struct{}{}
+	blockingConditions(r.root(), activatedBm, blocking)
+
+	r.condBitmap.Range(func(id uint32) {
+		c := r.conditions[id]
+		ce := ConditionExplanation{
+			Token:     c.token(),
+			Left:      c.lTerm.token(),
+			Operator:  c.operator.String(),
+			Right:     c.rTerm.token(),
+			RightFact: c.rTerm.isVariable(),
+			Negated:   c.negated,
+			Result:    activatedBm.Contains(id),
+		}
+		ce.LeftValue, ce.LeftMissing = termValue(c.lTerm, ctx)
+		ce.RightValue, ce.RightMissing = termValue(c.rTerm, ctx)
+
+		e.Conditions = append(e.Conditions, ce)
+		if _, isBlocking := blocking[id]; isBlocking {
+			e.Blocking = append(e.Blocking, ce.Token)
+		}
+	})
+
+	return e, nil
+}
+
+// blockingConditions collects the conditions that must change its result for the given group to be matched.
+// Only the conditions reached through all and none groups are known to block it.
+func blockingConditions(g *_group, bm bitmap.Bitmap, blocking map[cuid]struct{}) {
+	if g.match(bm) {
+		return
+	}
+
+	switch g.operator {
+	case opAnd:
+		for _, c := range g.conditions {
+			if !bm.Contains(c.id) {
+				blocking[c.id] = struct{}{}
+			}
+		}
+		for _, sub := range g.groups {
+			blockingConditions(sub, bm, blocking)
+		}
+	case opNone:
+		for _, c := range g.conditions {
+			if bm.Contains(c.id) {
+				blocking[c.id] = struct{}{}
+			}
+		}
+	}
+}
+
+// termValue returns the value compared by the term: the fact value for variable terms or the discrete value.
+// Variable terms without fact into the context are reported as missing, being compared with its zero value.
+func termValue(t iTerm, ctx _factContext) (interface{}, bool) {
+	if !t.isVariable() {
+		return t.val(), false
+	}
+
+	if f, ok := ctx.get(t.token()); ok {
+		return f.value(), false
+	}
+	return t.val(), true
+}
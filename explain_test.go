@@ -0,0 +1,69 @@
+package goldfish_re
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_explain(t *testing.T) {
+	ctx := newTestContext(t, newTestRuleset(), `
+		rule "frequent flyer" when all { User.plan == "gold"; User.miles > 3000; not User.status == "banned" } then "ACTIVE_GOLD_AWARD"
+		rule "long trip" when any { number Trip.miles > User.miles } then "LONG_TRIP"
+	`, NewString("User", "plan", "gold"), NewNumber("User", "miles", 2500))
+
+	e, err := ctx.Explain("frequent flyer")
+	assert.Nil(t, err)
+	assert.False(t, e.Activated)
+	assert.EqualValues(t, whenAll, e.Operator)
+	assert.Len(t, e.Conditions, 3)
+	assert.EqualValues(t, []string{"User.miles_>_3000", "!User.status_==_banned"}, e.Blocking)
+
+	assert.True(t, e.Conditions[0].Result)
+	assert.EqualValues(t, "gold", e.Conditions[0].LeftValue)
+	assert.EqualValues(t, int64(2500), e.Conditions[1].LeftValue)
+	assert.EqualValues(t, int64(3000), e.Conditions[1].RightValue)
+	assert.True(t, e.Conditions[2].Negated)
+	assert.True(t, e.Conditions[2].LeftMissing)
+
+	assert.EqualValues(t, `rule "frequent flyer" when all then "ACTIVE_GOLD_AWARD": not activated (version 1)
+  true  User.plan == gold (User.plan=gold)
+  false User.miles > 3000 (User.miles=2500) <- blocking
+  false not User.status == banned (User.status is missing) <- blocking
+`, e.String())
+
+	e, err = ctx.Explain("long trip")
+	assert.Nil(t, err)
+	assert.False(t, e.Activated)
+	assert.True(t, e.Conditions[0].RightFact)
+	assert.True(t, e.Conditions[0].LeftMissing)
+	assert.Empty(t, e.Blocking)
+
+	_, err = ctx.Explain("unknown")
+	assert.ErrorIs(t, err, ErrRuleNotFound)
+}
+
+func Test_explain_concurrent(t *testing.T) {
+	miles := NewNumber("User", "miles", 0)
+	ctx := newTestContext(t, newTestRuleset(), `rule "frequent flyer" when all { User.miles > 3000 } then "FLYER"`, miles)
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			assert.Nil(t, ctx.Update(func(tx *Tx) { tx.IncrementNumber(miles, 50) }))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_, err := ctx.Explain("frequent flyer")
+		assert.Nil(t, err)
+	}
+	wg.Wait()
+
+	e, err := ctx.Explain("frequent flyer")
+	assert.Nil(t, err)
+	assert.True(t, e.Activated)
+	assert.EqualValues(t, int64(5000), e.Conditions[0].LeftValue)
+}
@@ -0,0 +1,122 @@
+package goldfish_re
+
+import (
+	"fmt"
+	"sort"
+)
+
+// tFeedbackMode defines how the feedback transactions queued by the same evaluation are applied
+type tFeedbackMode uint8
+
+const (
+	// MergeFeedback queued feedback transactions are merged into a single transaction evaluated once
+	MergeFeedback tFeedbackMode = iota
+	// SequentialFeedback queued feedback transactions are committed one by one, evaluating the ruleset after each one
+	SequentialFeedback
+)
+
+// _feedback feedback transaction queued by an activation handler or by the rule actions
+type _feedback struct {
+	fn   func(tx *Tx)
+	rule string // rule whose activation queued the feedback, empty out of the activation handler
+}
+
+// feedbackBatch feedback transactions queued by the same evaluation.
+// It keeps the values set by each one of them to report the conflicts between them.
+type feedbackBatch struct {
+	feedbacks []_feedback
+	written   map[interface{}]interface{}
+}
+
+// newFeedbackBatch feedback batch constructor
+func newFeedbackBatch(feedbacks []_feedback) *feedbackBatch {
+	return &feedbackBatch{feedbacks: feedbacks, written: map[interface{}]interface{}{}}
+}
+
+// apply runs the given feedback over the transaction returning the conflicts with the facts set with a different value
+// by a previous feedback of the batch. Accumulated values, like increments, are not conflicts.
+func (b *feedbackBatch) apply(fb _feedback, tx *Tx) []error {
+	tx.accumulated = map[interface{}]struct{}{}
+	fb.fn(tx)
+
+	errs := make([]error, 0)
+	for obj, val := range tx.toApply {
+		prev, written := b.written[obj]
+		if _, accumulated := tx.accumulated[obj]; written && !accumulated && prev != val {
+			err := &EvalError{Rule: fb.rule, Cause: fmt.Errorf("%w: %v overrides %v", ErrFeedbackConflict, val, prev)}
+			if f, ok := obj.(interface{ token() string }); ok {
+				err.Fact = f.token()
+			}
+			errs = append(errs, err)
+		}
+		b.written[obj] = val
+	}
+	return errs
+}
+
+// merged returns a single feedback that applies the whole batch into the same transaction
+func (b *feedbackBatch) merged(fail func(errs ...error)) func(tx *Tx) {
+	return func(tx *Tx) {
+		for _, fb := range b.feedbacks {
+			fail(b.apply(fb, tx)...)
+		}
+	}
+}
+
+// sequential returns the given feedback of the batch applied into its own transaction
+func (b *feedbackBatch) sequential(fb _feedback, fail func(errs ...error)) func(tx *Tx) {
+	return func(tx *Tx) {
+		fail(b.apply(fb, tx)...)
+	}
+}
+
+// factHistory values taken by each fact during an update keyed by its token, the first one is the value before the update
+type factHistory map[string][]interface{}
+
+// trace records the values committed by the given transaction
+func (h factHistory) trace(tx *Tx) {
+	for obj, val := range tx.toApply {
+		f, ok := obj.(interface{ token() string })
+		if !ok {
+			continue
+		}
+
+		if _, traced := h[f.token()]; !traced {
+			h[f.token()] = []interface{}{factKindValue(obj)}
+		}
+		h[f.token()] = append(h[f.token()], val)
+	}
+}
+
+// oscillating returns the sorted tokens of the facts that returned to a previous value
+func (h factHistory) oscillating() []string {
+	tokens := make([]string, 0)
+	for token, values := range h {
+		seen := map[interface{}]struct{}{}
+		for i, v := range values {
+			if i > 0 && values[i-1] == v {
+				continue
+			}
+			if _, ok := seen[v]; ok {
+				tokens = append(tokens, token)
+				break
+			}
+			seen[v] = struct{}{}
+		}
+	}
+
+	sort.Strings(tokens)
+	return tokens
+}
+
+// newCycleError builds the diagnostics of an update that reached the given iterations with the dispatched activations
+func newCycleError(iterations int, activations []Activation, history factHistory) *CycleError {
+	e := &CycleError{Iterations: make([][]string, iterations+1), Oscillating: history.oscillating()}
+	for i := range e.Iterations {
+		e.Iterations[i] = make([]string, 0)
+	}
+	for _, a := range activations {
+		e.Iterations[a.Iteration] = append(e.Iterations[a.Iteration], a.Rule)
+	}
+	return e
+}
@@ -0,0 +1,112 @@
+package goldfish_re
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newFeedbackTestContext(t *testing.T, errs *[]error) (*factContext, String, Number, String, Number) {
+	rs := Builder().Ruleset().
+		OnActivation(func(then string, ctx Context) {
+			status, _ := ctx.GetString("User.status")
+			switch then {
+			case "GOLD":
+				ctx.Feedback(func(tx *Tx) { tx.SetString(status, "VIP") })
+			case "MILES":
+				ctx.Feedback(func(tx *Tx) { tx.SetString(status, "FLYER") })
+			}
+		}).
+		OnError(func(err error) { *errs = append(*errs, err) }).
+		Build()
+
+	plan, status, miles, points := NewString("User", "plan", "silver"), NewString("User", "status", "active"),
+		NewNumber("User", "miles", 0), NewNumber("User", "points", 0)
+	ctx := newTestContext(t, rs, `
+		rule "gold" when all { User.plan == "gold" } then "GOLD" { increment User.points 10 }
+		rule "miles" when all { User.miles > 3000 } then "MILES" { increment User.points 5 }
+	`, plan, status, miles, points)
+
+	assert.Nil(t, ctx.Update(func(tx *Tx) {
+		tx.SetString(plan, "gold")
+		tx.SetNumber(miles, 4000)
+	}))
+	return ctx, plan, miles, status, points
+}
+
+func Test_feedback_merge(t *testing.T) {
+	errs := make([]error, 0)
+	_, _, _, status, points := newFeedbackTestContext(t, &errs)
+
+	assert.EqualValues(t, "FLYER", status.Value())
+	assert.EqualValues(t, 15, points.Value())
+
+	if assert.Len(t, errs, 1) {
+		var evalErr *EvalError
+		assert.ErrorIs(t, errs[0], ErrFeedbackConflict)
+		assert.True(t, errors.As(errs[0], &evalErr))
+		assert.EqualValues(t, "miles", evalErr.Rule)
+		assert.EqualValues(t, "User.status", evalErr.Fact)
+	}
+}
+
+func Test_feedback_sequential(t *testing.T) {
+	errs := make([]error, 0)
+	ctx, plan, miles, status, points := newFeedbackTestContext(t, &errs)
+	errs = errs[:0]
+
+	ctx.WithFeedbackMode(SequentialFeedback)
+	activations, err := ctx.UpdateWithActivations(func(tx *Tx) {
+		tx.SetString(plan, "silver")
+		tx.SetNumber(miles, 0)
+	})
+	assert.Nil(t, err)
+	assert.Len(t, activations, 0)
+
+	activations, err = ctx.UpdateWithActivations(func(tx *Tx) {
+		tx.SetString(plan, "gold")
+		tx.SetNumber(miles, 4000)
+	})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"GOLD", "MILES"}, activationThens(activations))
+	assert.EqualValues(t, "FLYER", status.Value())
+	assert.EqualValues(t, 30, points.Value())
+	assert.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], ErrFeedbackConflict)
+}
+
+func Test_feedback_cycle(t *testing.T) {
+	plan := NewString("User", "plan", "bronze")
+	rs := Builder().Ruleset().
+		OnActivation(func(then string, ctx Context) {
+			switch then {
+			case "SILVER":
+				ctx.Feedback(func(tx *Tx) { tx.SetString(plan, "platinum") })
+			case "PLATINUM":
+				ctx.Feedback(func(tx *Tx) { tx.SetString(plan, "silver") })
+			}
+		}).
+		OnError(func(error) {}).
+		Build()
+
+	ctx := newTestContext(t, rs, `
+		rule "silver" when all { User.plan == "silver" } then "SILVER"
+		rule "platinum" when all { User.plan == "platinum" } then "PLATINUM"
+	`, plan)
+	ctx.WithMaxIterations(3)
+	err := ctx.SetString(plan, "silver")
+	assert.EqualError(t, err, "max feedback iterations reached after 3 iterations, oscillating facts [User.plan]")
+
+	cycleErr := newCycleError(2, []Activation{{Rule: "silver"}, {Rule: "platinum", Iteration: 1}}, factHistory{})
+	assert.EqualError(t, cycleErr, "max feedback iterations reached after 2 iterations")
+}
+
+func Test_feedback_oscillating(t *testing.T) {
+	h := factHistory{
+		"User.plan":   {"silver", "platinum", "silver"},
+		"User.status": {"active", "active", "VIP"},
+		"User.miles":  {int64(0), int64(10), int64(0), int64(10)},
+	}
+	assert.EqualValues(t, []string{"User.miles", "User.plan"}, h.oscillating())
+}
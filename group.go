@@ -0,0 +1,171 @@
+package goldfish_re
+
+import (
+	"fmt"
+
+	"github.com/kelindar/bitmap"
+)
+
+// Expression rule expression, a condition or a group of expressions
+type Expression interface {
+	expression()
+}
+
+// expression marks the condition as rule expression
+func (c *_condition) expression() {}
+
+// _group boolean group of conditions and nested groups.
+// The condition bitmap holds the IDs of its direct conditions once the group is compiled.
+// Threshold groups (AtLeast, AtMost, Exactly) compare the amount of matched expressions with its count.
+type _group struct {
+	operator   tBinaryOperator
+	count      int
+	conditions []*_condition
+	groups     []*_group
+	condBitmap *bitmap.Bitmap
+}
+
+// newGroup group constructor splitting the given expressions into conditions and nested groups
+func newGroup(operator tBinaryOperator, expressions ...Expression) *_group {
+	g := &_group{operator: operator, condBitmap: &bitmap.Bitmap{}}
+	for _, e := range expressions {
+		switch exp := e.(type) {
+		case *_condition:
+			g.conditions = append(g.conditions, exp)
+		case *_group:
+			g.groups = append(g.groups, exp)
+		}
+	}
+	return g
+}
+
+// newThresholdGroup threshold group constructor
+func newThresholdGroup(operator tBinaryOperator, n int, expressions ...Expression) *_group {
+	g := newGroup(operator, expressions...)
+	g.count = n
+	return g
+}
+
+// expression marks the group as rule expression
+func (g *_group) expression() {}
+
+// nested checks if the group cannot be matched as a flat rule: it has nested groups or negates its conditions
+func (g *_group) nested() bool {
+	return len(g.groups) > 0 || g.operator == opNone || g.operator.isThreshold()
+}
+
+// validate checks that the group and its nested groups have expressions and valid thresholds
+func (g *_group) validate() error {
+	n := len(g.conditions) + len(g.groups)
+	if n == 0 {
+		return ErrEmptyConditionList
+	}
+
+	if g.operator.isThreshold() && (g.count < 0 || g.count > n) {
+		return ErrInvalidThreshold
+	}
+
+	for _, sub := range g.groups {
+		if err := sub.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tokens returns the token of each group expression, conditions first
+func (g *_group) tokens() []string {
+	tokens := make([]string, 0, len(g.conditions)+len(g.groups))
+	for _, c := range g.conditions {
+		tokens = append(tokens, c.token())
+	}
+	for _, sub := range g.groups {
+		tokens = append(tokens, sub.token())
+	}
+	return tokens
+}
+
+// operatorToken returns the group operator token including the threshold count
+func (g *_group) operatorToken() string {
+	if g.operator.isThreshold() {
+		return fmt.Sprintf("%s%d", g.operator.token(), g.count)
+	}
+	return g.operator.token()
+}
+
+// when returns the group operator as it is written into the rule language, like all or atleast 3
+func (g *_group) when() string {
+	if g.operator.isThreshold() {
+		return fmt.Sprintf("%s %d", whenName(g.operator), g.count)
+	}
+	return whenName(g.operator)
+}
+
+// token group string representation
+func (g *_group) token() string {
+	return groupToken(g.tokens(), g.operatorToken())
+}
+
+// leaves returns the conditions of the group and its nested groups
+func (g *_group) leaves() []*_condition {
+	leaves := append([]*_condition{}, g.conditions...)
+	for _, sub := range g.groups {
+		leaves = append(leaves, sub.leaves()...)
+	}
+	return leaves
+}
+
+// compile returns a copy of the group whose conditions are replaced by the resolved ones, building its bitmaps
+func (g *_group) compile(resolve func(c *_condition) *_condition) *_group {
+	cg := &_group{operator: g.operator, count: g.count, condBitmap: &bitmap.Bitmap{}}
+	for _, c := range g.conditions {
+		rc := resolve(c)
+		cg.conditions = append(cg.conditions, rc)
+		cg.condBitmap.Set(rc.id)
+	}
+
+	for _, sub := range g.groups {
+		cg.groups = append(cg.groups, sub.compile(resolve))
+	}
+	return cg
+}
+
+// size returns the amount of distinct conditions and nested groups
+func (g *_group) size() int {
+	return g.condBitmap.Count() + len(g.groups)
+}
+
+// matched returns the amount of conditions and nested groups matched by the given activated conditions bitmap
+func (g *_group) matched(bm bitmap.Bitmap) int {
+	mem := &bitmap.Bitmap{}
+	g.condBitmap.Clone(mem)
+	mem.And(bm)
+
+	n := mem.Count()
+	for _, sub := range g.groups {
+		if sub.match(bm) {
+			n++
+		}
+	}
+	return n
+}
+
+// match checks if the group is matched by the given activated conditions bitmap
+func (g *_group) match(bm bitmap.Bitmap) bool {
+	switch g.operator {
+	case opAnd:
+		return g.matched(bm) == g.size()
+	case opOr:
+		return g.matched(bm) > 0
+	case opNone:
+		return g.matched(bm) == 0
+	case opAtLeast:
+		return g.matched(bm) >= g.count
+	case opAtMost:
+		return g.matched(bm) <= g.count
+	case opExactly:
+		return g.matched(bm) == g.count
+	default:
+		return false
+	}
+}
@@ -0,0 +1,78 @@
+package goldfish_re
+
+import "fmt"
+
+// tHitPolicy decision table hit policy: which of the matched rules are dispatched
+type tHitPolicy uint8
+
+const (
+	// CollectPolicy all matched rules are dispatched
+	CollectPolicy tHitPolicy = iota
+	// FirstPolicy only the first matched rule in definition order is dispatched, its salience is ignored
+	FirstPolicy
+	// UniquePolicy at most one rule can match, otherwise an error is sent to the error handler
+	UniquePolicy
+	// AnyPolicy all matched rules must agree on the then value, which is dispatched once
+	AnyPolicy
+	// PriorityPolicy only the matched rule with the highest salience is dispatched, ties are resolved by the strategy
+	PriorityPolicy
+)
+
+// String hit policy name
+func (p tHitPolicy) String() string {
+	switch p {
+	case CollectPolicy:
+		return "collect"
+	case FirstPolicy:
+		return "first"
+	case UniquePolicy:
+		return "unique"
+	case AnyPolicy:
+		return "any"
+	case PriorityPolicy:
+		return "priority"
+	default:
+		return undefined
+	}
+}
+
+// apply returns the rules to dispatch from the matched rules ordered by the agenda.
+// Rules that violate the policy are reported by an *EvalError and none of them is dispatched.
+func (p tHitPolicy) apply(rules []*_rule) ([]*_rule, error) {
+	if len(rules) <= 1 {
+		return rules, nil
+	}
+
+	switch p {
+	case UniquePolicy:
+		return nil, p.violation(rules)
+	case AnyPolicy:
+		for _, r := range rules[1:] {
+			if r.then != rules[0].then {
+				return nil, p.violation(rules)
+			}
+		}
+		return rules[:1], nil
+	case FirstPolicy:
+		first := rules[0]
+		for _, r := range rules[1:] {
+			if r.id < first.id {
+				first = r
+			}
+		}
+		return []*_rule{first}, nil
+	case PriorityPolicy:
+		return rules[:1], nil
+	default:
+		return rules, nil
+	}
+}
+
+// violation returns the error reported when the matched rules violate the policy
+func (p tHitPolicy) violation(rules []*_rule) error {
+	ids := make([]string, len(rules))
+	for i, r := range rules {
+		ids[i] = r.token
+	}
+	return &EvalError{Cause: fmt.Errorf("%w: %s policy matched rules %q", ErrHitPolicyViolation, p, ids)}
+}
@@ -0,0 +1,71 @@
+package goldfish_re
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_hitPolicy(t *testing.T) {
+	src := `
+		rule "standard" when all { User.miles > 1000 } then "DISCOUNT_5"
+		rule "gold" salience 10 when all { User.plan == "gold" } then "DISCOUNT_10"
+		rule "loyal" when all { User.years > 5 } then "DISCOUNT_5"
+	`
+
+	cases := []struct {
+		policy tHitPolicy
+		facts  map[string]interface{}
+		thens  []string
+		err    bool
+	}{
+		{CollectPolicy, map[string]interface{}{"User.miles": 2000, "User.plan": "gold"}, []string{"DISCOUNT_10", "DISCOUNT_5"}, false},
+		// for the same facts FIRST follows the definition order and PRIORITY the salience
+		{FirstPolicy, map[string]interface{}{"User.miles": 2000, "User.plan": "gold"}, []string{"DISCOUNT_5"}, false},
+		{FirstPolicy, map[string]interface{}{"User.plan": "gold", "User.years": 10}, []string{"DISCOUNT_10"}, false},
+		{PriorityPolicy, map[string]interface{}{"User.miles": 2000, "User.plan": "gold"}, []string{"DISCOUNT_10"}, false},
+		{UniquePolicy, map[string]interface{}{"User.plan": "gold"}, []string{"DISCOUNT_10"}, false},
+		{UniquePolicy, map[string]interface{}{"User.miles": 2000, "User.plan": "gold"}, []string{}, true},
+		{AnyPolicy, map[string]interface{}{"User.miles": 2000, "User.years": 10}, []string{"DISCOUNT_5"}, false},
+		{AnyPolicy, map[string]interface{}{"User.miles": 2000, "User.plan": "gold"}, []string{}, true},
+	}
+
+	for _, tc := range cases {
+		errs := make([]error, 0)
+		rs := Builder().Ruleset().HitPolicy(tc.policy).
+			OnActivation(func(string, Context) {}).
+			OnError(func(err error) { errs = append(errs, err) }).
+			Build()
+
+		addTestRules(t, rs, src)
+
+		activations, err := rs.Evaluate(tc.facts)
+		assert.EqualValues(t, tc.thens, activationThens(activations), tc.policy.String())
+		if tc.err {
+			assert.ErrorIs(t, err, ErrHitPolicyViolation, tc.policy.String())
+			assert.Len(t, errs, 1, tc.policy.String())
+		} else {
+			assert.Nil(t, err, tc.policy.String())
+			assert.Len(t, errs, 0, tc.policy.String())
+		}
+	}
+}
+
+func Test_hitPolicy_feedbackSkip(t *testing.T) {
+	rs := Builder().Ruleset().HitPolicy(FirstPolicy).
+		OnActivation(func(string, Context) {}).
+		OnError(func(error) {}).
+		Build()
+
+	plan, points := NewString("User", "plan", "silver"), NewNumber("User", "points", 0)
+	ctx := newTestContext(t, rs, `
+		rule "gold" salience 10 when all { User.plan == "gold" } then "GOLD" { increment User.points 10 }
+		rule "points" when all { User.points > 5 } then "POINTS"
+	`, plan, points)
+
+	// the skipped gold rule does not hide the points rule on the feedback iteration
+	activations, err := ctx.UpdateWithActivations(func(tx *Tx) { tx.SetString(plan, "gold") })
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"GOLD", "POINTS"}, activationThens(activations))
+	assert.EqualValues(t, 10, points.Value())
+}
@@ -0,0 +1,32 @@
+package goldfish_re
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+)
+
+// tReentrancy defines how an update called from the activation handler of the same context is handled
+type tReentrancy uint8
+
+const (
+	// DeferReentrant re-entrant updates are queued as feedback transactions applied after the current evaluation
+	DeferReentrant tReentrancy = iota
+	// RejectReentrant re-entrant updates fail with ErrReentrantUpdate
+	RejectReentrant
+)
+
+var goroutinePrefix = []byte("goroutine ")
+
+// goroutineID returns the calling goroutine id parsed from its stack header, only read while a handler is dispatched
+func goroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, goroutinePrefix)
+	if i := bytes.IndexByte(buf, ' '); i > 0 {
+		buf = buf[:i]
+	}
+
+	id, _ := strconv.ParseUint(string(buf), 10, 64)
+	return id
+}
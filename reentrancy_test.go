@@ -0,0 +1,69 @@
+package goldfish_re
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_reentrancy_goroutineID(t *testing.T) {
+	id := goroutineID()
+	assert.NotZero(t, id)
+	assert.EqualValues(t, id, goroutineID())
+
+	other := make(chan uint64)
+	go func() { other <- goroutineID() }()
+	assert.NotEqual(t, id, <-other)
+}
+
+func Test_reentrancy_update(t *testing.T) {
+	var ctx *factContext
+	var reentrantErr error
+	status := NewString("User", "status", "active")
+	rs := Builder().Ruleset().
+		OnActivation(func(then string, _ Context) {
+			if then == "GOLD" {
+				reentrantErr = ctx.SetString(status, "VIP")
+			}
+		}).
+		OnError(func(error) {}).
+		Build()
+
+	plan := NewString("User", "plan", "silver")
+	ctx = newTestContext(t, rs, `
+		rule "gold" when all { User.plan == "gold" } then "GOLD"
+		rule "vip" when all { User.status == "VIP" } then "VIP"
+	`, plan, status)
+
+	// deferred as feedback
+	activations, err := ctx.UpdateWithActivations(func(tx *Tx) { tx.SetString(plan, "gold") })
+	assert.Nil(t, err)
+	assert.Nil(t, reentrantErr)
+	assert.EqualValues(t, []string{"GOLD", "VIP"}, activationThens(activations))
+	assert.EqualValues(t, "VIP", status.Value())
+
+	// rejected
+	assert.Nil(t, ctx.Update(func(tx *Tx) {
+		tx.SetString(plan, "silver")
+		tx.SetString(status, "active")
+	}))
+	ctx.WithReentrancy(RejectReentrant)
+	activations, err = ctx.UpdateWithActivations(func(tx *Tx) { tx.SetString(plan, "gold") })
+	assert.Nil(t, err)
+	assert.ErrorIs(t, reentrantErr, ErrReentrantUpdate)
+	assert.EqualValues(t, []string{"GOLD"}, activationThens(activations))
+	assert.EqualValues(t, "active", status.Value())
+}
+
+func Test_reentrancy_reentrant(t *testing.T) {
+	ctx := newTestRuleset().Context()
+	assert.False(t, ctx.reentrant())
+
+	atomic.StoreUint64(&ctx.handler, goroutineID())
+	assert.True(t, ctx.reentrant())
+
+	other := make(chan bool)
+	go func() { other <- ctx.reentrant() }()
+	assert.False(t, <-other)
+}
@@ -1,6 +1,11 @@
 package goldfish_re
 
-import "github.com/kelindar/bitmap"
+import (
+	"sort"
+	"time"
+
+	"github.com/kelindar/bitmap"
+)
 
 const (
 	all = true
@@ -13,14 +18,93 @@ type _rule struct {
 	operator   tBinaryOperator
 	conditions map[cuid]*_condition
 	condBitmap *bitmap.Bitmap
+	group      *_group // nested groups, nil for flat rules
+	salience   int
+
+	// metadata
+	name        string
+	description string
+	owner       string
+	tags        []string
+	disabled    bool
+
+	// effective window, zero values are unbounded
+	effectiveFrom  time.Time
+	effectiveUntil time.Time
+	inEffect       bool
 
-	then string
+	then    string
+	outcome interface{}
+	actions []_action
 }
 
 func newRule(id ruid, operator tBinaryOperator, then string) *_rule {
 	return &_rule{id: id, operator: operator, conditions: map[cuid]*_condition{}, condBitmap: &bitmap.Bitmap{}, then: then}
 }
 
+// copyMetadata copies the metadata and salience of the given rule
+func (r *_rule) copyMetadata(from *_rule) {
+	r.token = from.token
+	r.salience = from.salience
+	r.name = from.name
+	r.description = from.description
+	r.owner = from.owner
+	r.tags = append([]string{}, from.tags...)
+	r.disabled = from.disabled
+	r.effectiveFrom = from.effectiveFrom
+	r.effectiveUntil = from.effectiveUntil
+	r.outcome = from.outcome
+	r.actions = from.actions
+}
+
+// windowed checks if the rule has an effective window
+func (r *_rule) windowed() bool {
+	return !r.effectiveFrom.IsZero() || !r.effectiveUntil.IsZero()
+}
+
+// effective checks if the given time is into the rule effective window [from, until)
+func (r *_rule) effective(now time.Time) bool {
+	if !r.effectiveFrom.IsZero() && now.Before(r.effectiveFrom) {
+		return false
+	}
+	return r.effectiveUntil.IsZero() || now.Before(r.effectiveUntil)
+}
+
+// hasTag checks if the rule is tagged with the given tag
+func (r *_rule) hasTag(tag string) bool {
+	for _, t := range r.tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Id returns the rule identifier used to remove or replace it from a ruleset
+func (r *_rule) Id() string {
+	return r.token
+}
+
+// match checks if the rule is activated by the given activated conditions bitmap
+func (r *_rule) match(bm bitmap.Bitmap) bool {
+	if r.group != nil {
+		return r.group.match(bm)
+	}
+
+	if r.operator == opAnd {
+		return r.matchAll(bm)
+	}
+	return r.matchAny(bm)
+}
+
+// root returns the rule root group, flat rules are represented as a single group of its conditions
+func (r *_rule) root() *_group {
+	if r.group != nil {
+		return r.group
+	}
+	return &_group{operator: r.operator, conditions: r.sortedConditions(), condBitmap: r.condBitmap}
+}
+
 func (r *_rule) matchAll(bm bitmap.Bitmap) bool {
 	rMem := &bitmap.Bitmap{}
 	r.condBitmap.Clone(rMem)
@@ -43,6 +127,16 @@ func (r *_rule) matchAny(bm bitmap.Bitmap) bool {
 	return false
 }
 
+// sortedConditions returns the rule conditions ordered by its ID
+func (r *_rule) sortedConditions() []*_condition {
+	conditions := make([]*_condition, 0, len(r.conditions))
+	for _, c := range r.conditions {
+		conditions = append(conditions, c)
+	}
+	sort.Slice(conditions, func(i, j int) bool { return conditions[i].id < conditions[j].id })
+	return conditions
+}
+
 func (r *_rule) addCondition(c *_condition) error {
 	if _, exists := r.conditions[c.id]; exists {
 		return errConditionAddedPreviously
@@ -6,8 +6,17 @@ const (
 	_ tBinaryOperator = iota
 	opAnd
 	opOr
+	opNone
+	opAtLeast
+	opAtMost
+	opExactly
 )
 
+// isThreshold checks if the operator compares the amount of matched expressions with the group count
+func (e tBinaryOperator) isThreshold() bool {
+	return e == opAtLeast || e == opAtMost || e == opExactly
+}
+
 func (e tBinaryOperator) token() string {
 	return e.String()
 }
@@ -18,6 +27,14 @@ func (e tBinaryOperator) String() string {
 		return "&&"
 	case opOr:
 		return "||"
+	case opNone:
+		return "!||"
+	case opAtLeast:
+		return "atleast"
+	case opAtMost:
+		return "atmost"
+	case opExactly:
+		return "exactly"
 	default:
 		return undefined
 	}
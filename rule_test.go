@@ -1,8 +1,11 @@
 package goldfish_re
 
 import (
+	"fmt"
+	"github.com/kelindar/bitmap"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func Test_rule_addCondition(t *testing.T) {
@@ -26,3 +29,213 @@ func Test_rule_addCondition(t *testing.T) {
 	assert.Nil(t, r2.addCondition(c4))
 	assert.Nil(t, r2.addCondition(c5))
 }
+
+func Test_rule_groupMatch(t *testing.T) {
+	// plan == gold && (miles > 3000 || status in [VIP]) && !(banned)
+	plan := Builder().StringCondition().Term("User", "plan").Equal("gold").Build()
+	miles := Builder().NumberCondition().Term("User", "miles").GreaterThan(3000).Build()
+	status := Builder().StringCondition().Term("User", "status").In([]string{"VIP"}).Build()
+	banned := Builder().BooleanCondition().Term("User", "banned").IsTrue().Build()
+
+	r, err := Builder().Rule().
+		AllOf(plan, Builder().AnyOf(miles, status), Builder().NoneOf(banned)).
+		Then("GOLD").
+		Build()
+	assert.Nil(t, err)
+	assert.Len(t, r.conditions, 4)
+	assert.EqualValues(t, "&&(User.plan_==_gold,||(User.miles_>_3000,User.status_in_[VIP]),!||(User.banned_==_true))=>GOLD", r.token)
+
+	bm := func(conditions ...*_condition) bitmap.Bitmap {
+		b := bitmap.Bitmap{}
+		for _, c := range conditions {
+			b.Set(c.id)
+		}
+		return b
+	}
+
+	assert.True(t, r.match(bm(plan, miles)))
+	assert.True(t, r.match(bm(plan, status)))
+	assert.False(t, r.match(bm(plan)))
+	assert.False(t, r.match(bm(miles, status)))
+	assert.False(t, r.match(bm(plan, miles, banned)))
+
+	none, err := Builder().Rule().NoneOf(banned).Then("NOT_BANNED").Build()
+	assert.Nil(t, err)
+	assert.True(t, none.match(bitmap.Bitmap{}))
+
+	_, err = Builder().Rule().AllOf(plan, Builder().AnyOf()).Then("EMPTY").Build()
+	assert.ErrorIs(t, err, ErrEmptyConditionList)
+}
+
+func Test_rule_thresholdMatch(t *testing.T) {
+	signals := make([]Expression, 5)
+	conditions := make([]*_condition, 5)
+	for i := range signals {
+		conditions[i] = Builder().BooleanCondition().Term("Signal", fmt.Sprintf("s%d", i)).IsTrue().Build()
+		signals[i] = conditions[i]
+	}
+
+	atLeast, err := Builder().Rule().AtLeast(3, signals...).Then("FRAUD").Build()
+	assert.Nil(t, err)
+	assert.EqualValues(t, opAtLeast, atLeast.operator)
+	atMost, _ := Builder().Rule().AtMost(1, signals...).Then("CLEAN").Build()
+	exactly, _ := Builder().Rule().Exactly(2, signals...).Then("REVIEW").Build()
+
+	cases := []struct {
+		active  int
+		atLeast bool
+		atMost  bool
+		exactly bool
+	}{
+		{0, false, true, false},
+		{1, false, true, false},
+		{2, false, false, true},
+		{3, true, false, false},
+		{5, true, false, false},
+	}
+
+	for _, tc := range cases {
+		bm := bitmap.Bitmap{}
+		for _, c := range conditions[:tc.active] {
+			bm.Set(c.id)
+		}
+		assert.EqualValues(t, tc.atLeast, atLeast.match(bm), tc.active)
+		assert.EqualValues(t, tc.atMost, atMost.match(bm), tc.active)
+		assert.EqualValues(t, tc.exactly, exactly.match(bm), tc.active)
+	}
+
+	_, err = Builder().Rule().AtLeast(6, signals...).Then("NEVER").Build()
+	assert.ErrorIs(t, err, ErrInvalidThreshold)
+}
+
+func Test_rule_nestedGroups(t *testing.T) {
+	rs := newTestRuleset()
+	plan, miles := NewString("User", "plan", "gold"), NewNumber("User", "miles", 100)
+	ctx := newTestContext(t, rs, `
+		rule "gold" when all { User.plan == "gold"; any { User.miles > 3000; User.status in ["VIP"] } } then "GOLD"
+		rule "not banned" when none { User.banned == true } then "NOT_BANNED"
+	`, plan, miles)
+
+	activations, err := ctx.UpdateWithActivations(func(tx *Tx) {})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"NOT_BANNED"}, activationThens(activations))
+
+	usr, _ := ctx.GetObject("User")
+	status, banned := NewString("User", "status", "VIP"), NewBoolean("User", "banned", false)
+	assert.Nil(t, ctx.RegisterString(usr, status))
+	assert.Nil(t, ctx.RegisterBoolean(usr, banned))
+	activations, err = ctx.UpdateWithActivations(func(tx *Tx) { tx.SetBoolean(banned, true) })
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"GOLD"}, activationThens(activations))
+
+	assert.Nil(t, rs.RemoveRule("not banned"))
+	assert.Len(t, rs.current().negativeRules, 0)
+}
+
+func Test_rule_threshold(t *testing.T) {
+	country, amount := NewString("Card", "country", "AR"), NewNumber("Card", "amount", 5000)
+	ctx := newTestContext(t, newTestRuleset(),
+		`rule "fraud" when atleast 2 { Card.country != "AR"; Card.amount > 1000; Card.night == true } then "FRAUD"`,
+		country, amount)
+
+	activations, err := ctx.UpdateWithActivations(func(tx *Tx) {})
+	assert.Nil(t, err)
+	assert.Len(t, activations, 0)
+
+	activations, err = ctx.UpdateWithActivations(func(tx *Tx) { tx.SetString(country, "US") })
+	assert.Nil(t, err)
+	if assert.Len(t, activations, 1) {
+		assert.EqualValues(t, 2, activations[0].Matched)
+	}
+
+	e, err := ctx.Explain("fraud")
+	assert.Nil(t, err)
+	assert.EqualValues(t, "atleast 2", e.Operator)
+}
+
+func Test_rule_metadata(t *testing.T) {
+	rs := newTestRuleset()
+
+	c1 := Builder().StringCondition().Term("User", "plan").Equal("gold").Build()
+	r1, _ := Builder().Rule().Id("gold").Name("Gold plan").Description("Gold users").Owner("loyalty").Tags("award", "plan").
+		AllOf(c1).Then("GOLD").Build()
+	c2 := Builder().NumberCondition().Term("User", "miles").GreaterThan(3000).Build()
+	r2, _ := Builder().Rule().Id("miles").Name("Frequent flyer").Tags("award").AllOf(c2).Then("MILES").Build()
+	c3 := Builder().StringCondition().Term("User", "plan").Equal("gold").Build()
+	r3, _ := Builder().Rule().Id("draft").Disabled().AllOf(c3).Then("DRAFT").Build()
+	for _, r := range []*_rule{r1, r2, r3} {
+		assert.Nil(t, rs.AddRule(r))
+	}
+
+	assert.EqualValues(t, []RuleInfo{
+		{Id: "gold", Name: "Gold plan", Description: "Gold users", Owner: "loyalty", Tags: []string{"award", "plan"}, Enabled: true, Then: "GOLD"},
+		{Id: "miles", Name: "Frequent flyer", Tags: []string{"award"}, Enabled: true, Then: "MILES"},
+	}, rs.RulesByTag("award"))
+	assert.Len(t, rs.Rules(), 3)
+	assert.Len(t, rs.RulesByTag("unknown"), 0)
+
+	facts := map[string]interface{}{"User.plan": "gold", "User.miles": 4000}
+	activations, err := rs.Evaluate(facts)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"GOLD", "MILES"}, activationThens(activations))
+	assert.EqualValues(t, "Gold plan", activations[0].Name)
+
+	assert.Nil(t, rs.DisableRule("gold"))
+	assert.Nil(t, rs.EnableRule("draft"))
+	activations, err = rs.Evaluate(facts)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"MILES", "DRAFT"}, activationThens(activations))
+
+	ctx := newTestContext(t, rs, emptyStr, NewString("User", "plan", "gold"))
+	e, err := ctx.Explain("gold")
+	assert.Nil(t, err)
+	assert.True(t, e.Disabled)
+	assert.False(t, e.Activated)
+
+	assert.ErrorIs(t, rs.DisableRule("unknown"), ErrRuleNotFound)
+}
+
+func Test_rule_effectiveWindow(t *testing.T) {
+	now := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+	events := make([]RuleLifecycle, 0)
+	rs := Builder().Ruleset().
+		Clock(func() time.Time { return now }).
+		OnLifecycle(func(e RuleLifecycle) { events = append(events, e) }).
+		OnActivation(func(string, Context) {}).
+		OnError(func(error) {}).
+		Build()
+
+	c := Builder().StringCondition().Term("User", "plan").Equal("gold").Build()
+	r, err := Builder().Rule().Id("black friday").
+		EffectiveFrom(time.Date(2022, 11, 25, 0, 0, 0, 0, time.UTC)).
+		EffectiveUntil(time.Date(2022, 11, 28, 0, 0, 0, 0, time.UTC)).
+		AllOf(c).Then("DISCOUNT").Build()
+	assert.Nil(t, err)
+	assert.Nil(t, rs.AddRule(r))
+
+	facts := map[string]interface{}{"User.plan": "gold"}
+	activations, _ := rs.Evaluate(facts)
+	assert.Len(t, activations, 0)
+	assert.Len(t, events, 0)
+
+	now = time.Date(2022, 11, 25, 10, 0, 0, 0, time.UTC)
+	activations, _ = rs.Evaluate(facts)
+	assert.Len(t, activations, 1)
+	assert.EqualValues(t, []RuleLifecycle{{Rule: "black friday", Effective: true, At: now}}, events)
+
+	now = time.Date(2022, 11, 28, 0, 0, 0, 0, time.UTC)
+	ctx := newTestContext(t, rs, emptyStr, NewString("User", "plan", "gold"))
+	activations, _ = ctx.UpdateWithActivations(func(tx *Tx) {})
+	assert.Len(t, activations, 0)
+	if assert.Len(t, events, 2) {
+		assert.False(t, events[1].Effective)
+	}
+
+	e, err := ctx.Explain("black friday")
+	assert.Nil(t, err)
+	assert.False(t, e.Effective)
+	assert.False(t, e.Activated)
+
+	_, err = Builder().Rule().EffectiveFrom(now).EffectiveUntil(now).AllOf(c).Then("NEVER").Build()
+	assert.ErrorIs(t, err, ErrInvalidEffectiveWindow)
+}
@@ -3,8 +3,10 @@ package goldfish_re
 import (
 	"github.com/darksubmarine/goldfish-re/trie"
 	"github.com/kelindar/bitmap"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const (
@@ -13,7 +15,12 @@ const (
 )
 
 type _ruleset struct {
-	mtx           sync.Mutex
+	mtx         sync.Mutex
+	name        string
+	description string
+	schema      _schema
+	clock       func() time.Time
+
 	ctrRules      uint32
 	ctrConditions uint32
 
@@ -23,16 +30,20 @@ type _ruleset struct {
 	conditions []*_condition
 	rules      []*_rule
 
-	conditionRef map[string]*_condition
-	idx          *trie.PathTrie
+	conditionRef  map[string]*_condition
+	ruleRef       map[string]*_rule
+	negativeRules map[ruid]*_rule // rules matched without active conditions, like NoneOf groups
+	idx           *trie.PathTrie
 }
 
 func newRuleset() *_ruleset {
 	return &_ruleset{
-		conditions:   make([]*_condition, defaultConditions),
-		rules:        make([]*_rule, defaultRules),
-		conditionRef: map[string]*_condition{},
-		idx:          trie.NewPathTrie(),
+		conditions:    make([]*_condition, defaultConditions),
+		rules:         make([]*_rule, defaultRules),
+		conditionRef:  map[string]*_condition{},
+		ruleRef:       map[string]*_rule{},
+		negativeRules: map[ruid]*_rule{},
+		idx:           trie.NewPathTrie(),
 	}
 }
 
@@ -52,22 +63,115 @@ func (rs *_ruleset) nextCuid() cuid {
 	return atomic.AddUint32(&rs.lcuid, 1)
 }
 
-func (rs *_ruleset) addRule(rule *_rule) {
-	// TODO check if given rule is not present before to add it
+// addRule thread-safe rule addition.
+// Rules with an identifier (token) already present into the ruleset are rejected.
+func (rs *_ruleset) addRule(rule *_rule) error {
 	rs.mtx.Lock()
 	defer rs.mtx.Unlock()
 
-	// cloning rule
-	ruleToAdd := newRule(rs.nextRuid(), rule.operator, rule.then)
+	return rs.add(rule)
+}
+
+// removeRule thread-safe rule removal by its identifier
+func (rs *_ruleset) removeRule(token string) error {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	return rs.remove(token)
+}
 
-	for _, c := range rule.conditions {
+// replaceRule thread-safe rule replacement. The given rule takes the identifier of the replaced one
+func (rs *_ruleset) replaceRule(token string, rule *_rule) error {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	replaced, exists := rs.ruleRef[token]
+	if !exists {
+		return ErrRuleNotFound
+	}
+
+	if err := rs.schema.checkRule(rule); err != nil {
+		return err
+	}
+
+	if err := rs.remove(token); err != nil {
+		return err
+	}
+
+	// the replacement keeps the ruid, so its definition order too
+	rs.link(rule, replaced.id, token)
+	return noErr
+}
+
+// enableRule thread-safe enabling or disabling of the rule with the given identifier.
+// Disabled rules keep its conditions into the ruleset but they are never activated.
+func (rs *_ruleset) enableRule(token string, enabled bool) error {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	r, exists := rs.ruleRef[token]
+	if !exists {
+		return ErrRuleNotFound
+	}
+
+	r.disabled = !enabled
+	return nil
+}
+
+// rulesInfo thread-safe listing of the rules metadata in definition order.
+// If a tag is given only the rules tagged with it are returned.
+func (rs *_ruleset) rulesInfo(tag string) []RuleInfo {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	rules := make([]RuleInfo, 0)
+	for _, r := range rs.rules {
+		if r == nil || (tag != emptyStr && !r.hasTag(tag)) {
+			continue
+		}
+		rules = append(rules, newRuleInfo(r))
+	}
+	return rules
+}
+
+// add clones the given rule and links it with the ruleset conditions. Must be called holding the ruleset lock.
+// Rules whose conditions don't match the fact schema are rejected.
+func (rs *_ruleset) add(rule *_rule) error {
+	if rule.token != emptyStr {
+		if _, exists := rs.ruleRef[rule.token]; exists {
+			return ErrRuleAddedPreviously
+		}
+	}
+
+	if err := rs.schema.checkRule(rule); err != nil {
+		return err
+	}
+
+	rs.link(rule, rs.nextRuid(), rule.token)
+	return noErr
+}
+
+// link clones the given rule with the given ruid and identifier, linking it with the ruleset conditions.
+// The given rule is not modified. Must be called holding the ruleset lock.
+func (rs *_ruleset) link(rule *_rule, id ruid, token string) {
+	// cloning rule
+	ruleToAdd := newRule(id, rule.operator, rule.then)
+	ruleToAdd.copyMetadata(rule)
+	ruleToAdd.token = token
+	ruleToAdd.inEffect = ruleToAdd.effective(rs.now())
+
+	resolved := make(map[string]*_condition, len(rule.conditions))
+	added := make([]*_condition, 0)
+	for _, c := range rule.sortedConditions() {
 		if cond, existsInRuleset := rs.conditionRef[c.token_]; existsInRuleset {
 
+			resolved[c.token_] = cond
 			ruleToAdd.addCondition(cond)
 			cond.addRule(ruleToAdd) // cycle ref
 
 		} else {
 			condToAdd := c.cloneWithId(rs.nextCuid())
+			resolved[c.token_] = condToAdd
 			ruleToAdd.addCondition(condToAdd)
 			condToAdd.addRule(ruleToAdd) // cycle ref
 
@@ -80,32 +184,112 @@ func (rs *_ruleset) addRule(rule *_rule) {
 			rs.conditions[condToAdd.id] = condToAdd
 			rs.conditionRef[condToAdd.token_] = condToAdd
 			rs.ctrConditions++
+			added = append(added, condToAdd)
 		}
 	}
 
+	// facts indexed before the new conditions existed must be evaluated again
+	rs.invalidate(added...)
+
 	// check slice size and growth if needed
 	if ruid(len(rs.rules)) <= ruleToAdd.id {
 		rs.rules = growthSlice[*_rule](rs.rules, defaultRules)
 	}
 
+	if rule.group != nil {
+		ruleToAdd.group = rule.group.compile(func(c *_condition) *_condition { return resolved[c.token_] })
+	}
+
+	// rules matched without active conditions must be checked on each evaluation
+	if ruleToAdd.match(bitmap.Bitmap{}) {
+		rs.negativeRules[ruleToAdd.id] = ruleToAdd
+	}
+
 	rs.rules[ruleToAdd.id] = ruleToAdd
+	if ruleToAdd.token != emptyStr {
+		rs.ruleRef[ruleToAdd.token] = ruleToAdd
+	}
 	rs.ctrRules++
 }
 
-func (rs *_ruleset) wme(fact iFact, ctx _factContext) {
+// remove unlinks the rule from its conditions and removes the conditions that are not used by other rules.
+// Must be called holding the ruleset lock
+func (rs *_ruleset) remove(token string) error {
+	r, exists := rs.ruleRef[token]
+	if !exists {
+		return ErrRuleNotFound
+	}
+
+	removed := make([]*_condition, 0)
+	for _, c := range r.conditions {
+		if c.removeRule(r) > 0 {
+			continue
+		}
+
+		// condition without rules
+		rs.conditions[c.id] = nil
+		delete(rs.conditionRef, c.token_)
+		rs.ctrConditions--
+		removed = append(removed, c)
+	}
+	rs.invalidate(removed...)
+
+	rs.rules[r.id] = nil
+	delete(rs.ruleRef, token)
+	delete(rs.negativeRules, r.id)
+	rs.ctrRules--
+	return noErr
+}
+
+// invalidate deletes the alpha nodes of the facts involved into the given conditions walking the index once.
+// The nodes will be created again by the wme on the next evaluation.
+func (rs *_ruleset) invalidate(conditions ...*_condition) {
+	if len(conditions) == 0 {
+		return
+	}
+
+	prefixes := make([]string, 0, len(conditions))
+	for _, c := range conditions {
+		prefixes = append(prefixes, indexPathPrefix(c.lTerm.object(), c.lTerm.attribute()))
+		if c.rTerm.isVariable() {
+			prefixes = append(prefixes, indexPathPrefix(c.rTerm.object(), c.rTerm.attribute()))
+		}
+	}
+
+	toDelete := make([]string, 0)
+	_ = rs.idx.Walk(func(key string, value interface{}) error {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				toDelete = append(toDelete, key)
+				break
+			}
+		}
+		return nil
+	})
+
+	for _, key := range toDelete {
+		rs.idx.Delete(key)
+	}
+}
+
+// wme builds the alpha node of the given fact returning the errors found evaluating the conditions
+func (rs *_ruleset) wme(fact iFact, ctx _factContext) []error {
 
 	path := indexPath(fact.object(), fact.attribute(), fact.value())
 	if node := rs.idx.Get(path); node != nil {
-		return
+		return nil
 	}
 
+	var errs []error
 	var activeConditions = make([]*_condition, 0)
 	betaNodes := make(map[cuid]_beta)
 	for _, c := range rs.conditions {
 		if c == nil {
 			continue
 		}
-		if ok, relFact := c.eval(fact, ctx); ok {
+		ok, relFact, cErrs := c.safeEval(fact, ctx)
+		errs = append(errs, cErrs...)
+		if ok {
 			if relFact == nil {
 				activeConditions = append(activeConditions, c)
 			} else {
@@ -129,17 +313,74 @@ func (rs *_ruleset) wme(fact iFact, ctx _factContext) {
 			}
 		}
 	}
+
+	return errs
+}
+
+// safeEvalFacts thread-safe evalFacts also returning the activated conditions bitmap and the evaluation errors.
+// Rules can be added or removed while contexts are evaluated
+func (rs *_ruleset) safeEvalFacts(ctx _factContext) ([]*_rule, bitmap.Bitmap, []error) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	activatedBm, partialActivation, errs := rs.activate(ctx)
+	return rs.match(activatedBm, partialActivation), activatedBm, errs
+}
+
+// safeEvalFactsWithoutIndex thread-safe evaluation of each condition against the given facts without reading or writing
+// the alpha index, so one-shot facts are not kept into it. Returns the activated rules and conditions bitmap and the
+// evaluation errors.
+func (rs *_ruleset) safeEvalFactsWithoutIndex(ctx _factContext) ([]*_rule, bitmap.Bitmap, []error) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	activatedBm, partialActivation, errs := rs.activateWithoutIndex(ctx)
+	return rs.match(activatedBm, partialActivation), activatedBm, errs
 }
 
 func (rs *_ruleset) evalFacts(ctx _factContext) []*_rule {
+	activatedBm, partialActivation, _ := rs.activate(ctx)
+	return rs.match(activatedBm, partialActivation)
+}
+
+// activateWithoutIndex returns the bitmap of conditions activated by the given facts and the rules linked to them
+// evaluating each condition without the alpha index.
+func (rs *_ruleset) activateWithoutIndex(ctx _factContext) (bitmap.Bitmap, []*_rule, []error) {
+	activatedBm := bitmap.Bitmap{}
+	partialActivation := []*_rule{}
+	var errs []error
+
+	for _, c := range rs.conditions {
+		if c == nil {
+			continue
+		}
+
+		for _, fact := range ctx {
+			ok, _, cErrs := c.safeEval(fact, ctx)
+			errs = append(errs, cErrs...)
+			if ok {
+				activatedBm.Set(c.id)
+				partialActivation = append(partialActivation, c.ruleSlice...)
+				break
+			}
+		}
+	}
+
+	return activatedBm, partialActivation, errs
+}
+
+// activate returns the bitmap of conditions activated by the given facts and the rules linked to them.
+// Facts not indexed yet are added into the alpha index, returning the errors found evaluating them.
+func (rs *_ruleset) activate(ctx _factContext) (bitmap.Bitmap, []*_rule, []error) {
 	activatedBm := bitmap.Bitmap{}
 	partialActivation := []*_rule{}
+	var errs []error
 
 	for _, fact := range ctx {
 		path := indexPathFact(fact)
 		node := rs.idx.Get(path)
 		if node == nil { // if we don't have node yet.. just add it!
-			rs.wme(fact, ctx)
+			errs = append(errs, rs.wme(fact, ctx)...)
 			node = rs.idx.Get(path)
 		}
 
@@ -173,20 +414,56 @@ func (rs *_ruleset) evalFacts(ctx _factContext) []*_rule {
 		}
 	}
 
+	return activatedBm, partialActivation, errs
+}
+
+// now returns the current time from the ruleset clock
+func (rs *_ruleset) now() time.Time {
+	if rs.clock == nil {
+		return time.Now()
+	}
+	return rs.clock()
+}
+
+// lifecycle thread-safe check of the rules effective windows.
+// Returns the rules that became effective or expired since the previous check.
+func (rs *_ruleset) lifecycle() []RuleLifecycle {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	now := rs.now()
+	events := make([]RuleLifecycle, 0)
+	for _, r := range rs.rules {
+		if r == nil || !r.windowed() {
+			continue
+		}
+
+		if effective := r.effective(now); effective != r.inEffect {
+			r.inEffect = effective
+			events = append(events, RuleLifecycle{Rule: r.token, Name: r.name, Effective: effective, At: now})
+		}
+	}
+	return events
+}
+
+// match returns the rules activated by the given conditions bitmap indexed by its ID.
+// Disabled rules and rules out of its effective window are skipped.
+func (rs *_ruleset) match(activatedBm bitmap.Bitmap, partialActivation []*_rule) []*_rule {
+	now := rs.now()
 	_activeSlice := make([]*_rule, len(rs.rules))
 	for _, r := range partialActivation {
-		if _activeSlice[r.id] != nil {
+		if _activeSlice[r.id] != nil || r.disabled || !r.effective(now) {
 			continue
 		}
 
-		if r.operator == opAnd {
-			if r.matchAll(activatedBm) {
-				_activeSlice[r.id] = r
-			}
-		} else {
-			if r.matchAny(activatedBm) {
-				_activeSlice[r.id] = r
-			}
+		if r.match(activatedBm) {
+			_activeSlice[r.id] = r
+		}
+	}
+
+	for id, r := range rs.negativeRules {
+		if _activeSlice[id] == nil && !r.disabled && r.effective(now) && r.match(activatedBm) {
+			_activeSlice[id] = r
 		}
 	}
 
@@ -5,6 +5,7 @@ import (
 	"math"
 	"sync"
 	"testing"
+	"time"
 )
 
 func Test_ruleset_nextRuid(t *testing.T) {
@@ -193,3 +194,291 @@ func Test_ruleset_evalFact(t *testing.T) {
 
 	assert.EqualValues(t, 1, activated)
 }
+
+func Test_ruleset_removeRule(t *testing.T) {
+	rs := newRuleset()
+
+	c1 := newCondition(1, newStringVarTerm("User", "plan"), newDiscreteStringTerm("gold"), opEquals)
+	c2 := newCondition(2, newNumberVarTerm("User", "miles"), newDiscreteNumberTerm(300), opGreaterThan)
+	c3 := newCondition(3, newNumberVarTerm("Trip", "miles"), newNumberVarTerm("User", "miles"), opGreaterThan)
+
+	r1, _ := Builder().Rule().Id("r1").AllOf(c1, c2).Then("apply").Build()
+	r2, _ := Builder().Rule().Id("r2").AnyOf(c2, c3).Then("apply").Build()
+
+	assert.Nil(t, rs.addRule(r1))
+	assert.Nil(t, rs.addRule(r2))
+	assert.ErrorIs(t, rs.addRule(r1), ErrRuleAddedPreviously)
+	assert.EqualValues(t, 3, rs.lenc())
+
+	factCtx := _factContext{}
+	factCtx.set(newString("User", "plan", "gold"))
+	factCtx.set(newNumber("User", "miles", 500))
+	factCtx.set(newNumber("Trip", "miles", 1300))
+	assert.Len(t, activeRules(rs.evalFacts(factCtx)), 2)
+
+	assert.Nil(t, rs.removeRule("r2"))
+	assert.ErrorIs(t, rs.removeRule("r2"), ErrRuleNotFound)
+	assert.EqualValues(t, 1, rs.lenr())
+	assert.EqualValues(t, 2, rs.lenc())
+	assert.NotContains(t, rs.conditionRef, c3.token())
+	assert.Nil(t, rs.idx.Get("/Trip/miles/1300"))
+	assert.Len(t, rs.conditionRef[c2.token()].ruleSlice, 1)
+
+	active := activeRules(rs.evalFacts(factCtx))
+	assert.Len(t, active, 1)
+	assert.EqualValues(t, "r1", active[0].token)
+}
+
+func Test_ruleset_replaceRule(t *testing.T) {
+	rs := newRuleset()
+
+	c1 := newCondition(1, newNumberVarTerm("User", "miles"), newDiscreteNumberTerm(3000), opGreaterThan)
+	r1, _ := Builder().Rule().Id("r1").AllOf(c1).Then("apply").Build()
+	assert.Nil(t, rs.addRule(r1))
+
+	factCtx := _factContext{}
+	factCtx.set(newNumber("User", "miles", 2500))
+	assert.Len(t, activeRules(rs.evalFacts(factCtx)), 0)
+
+	c2 := newCondition(1, newNumberVarTerm("User", "miles"), newDiscreteNumberTerm(2000), opGreaterThan)
+	r2, _ := Builder().Rule().AllOf(c2).Then("apply").Build()
+	assert.ErrorIs(t, rs.replaceRule("unknown", r2), ErrRuleNotFound)
+	r2Token := r2.token
+	assert.Nil(t, rs.replaceRule("r1", r2))
+	assert.EqualValues(t, 1, rs.lenr())
+	assert.EqualValues(t, 1, rs.lenc())
+	assert.EqualValues(t, r2Token, r2.token)
+
+	active := activeRules(rs.evalFacts(factCtx))
+	assert.Len(t, active, 1)
+	assert.EqualValues(t, "r1", active[0].token)
+
+	// the replaced rule keeps its definition order
+	c3 := newCondition(1, newNumberVarTerm("User", "miles"), newDiscreteNumberTerm(1000), opGreaterThan)
+	r3, _ := Builder().Rule().Id("r3").AllOf(c3).Then("apply").Build()
+	assert.Nil(t, rs.addRule(r3))
+	assert.Nil(t, rs.replaceRule("r1", r1))
+	ids := make([]string, 0)
+	for _, info := range rs.rulesInfo(emptyStr) {
+		ids = append(ids, info.Id)
+	}
+	assert.EqualValues(t, []string{"r1", "r3"}, ids)
+}
+
+func Test_ruleset_removeRuleWhileEvaluating(t *testing.T) {
+	rs := newTestRuleset()
+	miles := NewNumber("User", "miles", 0)
+	ctx := newTestContext(t, rs, emptyStr, miles)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := int64(0); i < 200; i++ {
+			assert.Nil(t, ctx.SetNumber(miles, i))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := int64(0); i < 200; i++ {
+			c := Builder().NumberCondition().Term("User", "miles").GreaterThan(i % 10).Build()
+			r, _ := Builder().Rule().Id("r").AllOf(c).Then("apply").Build()
+			assert.Nil(t, rs.AddRule(r))
+			assert.Nil(t, rs.RemoveRule("r"))
+		}
+	}()
+	wg.Wait()
+	assert.EqualValues(t, 0, rs.current().lenr())
+	assert.EqualValues(t, 0, rs.current().lenc())
+}
+
+func activeRules(rules []*_rule) []*_rule {
+	active := make([]*_rule, 0)
+	for _, r := range rules {
+		if r != nil {
+			active = append(active, r)
+		}
+	}
+	return active
+}
+
+func Test_ruleset_swap(t *testing.T) {
+	activations := map[string]uint64{}
+	rs := Builder().Ruleset().
+		OnActivation(func(then string, ctx Context) { activations[then] = ctx.Version() }).
+		OnError(func(error) {}).
+		Build()
+
+	miles := NewNumber("User", "miles", 0)
+	ctx := newTestContext(t, rs, `rule "v1" when all { User.miles > 3000 } then "v1"`, miles)
+	assert.EqualValues(t, 1, rs.Version())
+	assert.Nil(t, ctx.SetNumber(miles, 3500))
+	assert.EqualValues(t, map[string]uint64{"v1": 1}, activations)
+
+	// the new version is built off to the side
+	next := rs.NewVersion()
+	c2 := Builder().NumberCondition().Term("User", "miles").GreaterThan(2000).Build()
+	r2, _ := Builder().Rule().AllOf(c2).Then("v2").Build()
+	assert.Nil(t, next.AddRule(r2))
+
+	assert.Nil(t, ctx.SetNumber(miles, 3600))
+	assert.EqualValues(t, map[string]uint64{"v1": 1}, activations)
+
+	v, err := rs.Swap(next)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, v)
+	assert.EqualValues(t, 2, rs.Version())
+
+	delete(activations, "v1")
+	assert.Nil(t, ctx.SetNumber(miles, 3700))
+	assert.EqualValues(t, map[string]uint64{"v2": 2}, activations)
+	assert.EqualValues(t, 2, ctx.Version())
+
+	// the swapped ruleset is read-only
+	r3, _ := Builder().Rule().AllOf(c2).Then("v3").Build()
+	assert.ErrorIs(t, next.AddRule(r3), ErrRulesetSwapped)
+	assert.ErrorIs(t, next.DisableRule(r2.token), ErrRulesetSwapped)
+	_, err = rs.Swap(next)
+	assert.ErrorIs(t, err, ErrRulesetSwapped)
+
+	_, err = rs.Swap(nil)
+	assert.ErrorIs(t, err, ErrInvalidRulesetVersion)
+	_, err = rs.Swap(rs)
+	assert.ErrorIs(t, err, ErrInvalidRulesetVersion)
+}
+
+func Test_ruleset_swapConfiguration(t *testing.T) {
+	src := `
+		rule "standard" when all { User.miles > 1000 } then "DISCOUNT_5"
+		rule "gold" salience 10 when all { User.plan == "gold" } then "DISCOUNT_10"
+	`
+
+	// the strategy, hit policy and lifecycle handler of the next version are published with its rules
+	rs := newTestRuleset()
+	next := Builder().Ruleset().HitPolicy(FirstPolicy).OnActivation(func(string, Context) {}).OnError(func(error) {}).Build()
+	addTestRules(t, rs, src)
+	addTestRules(t, next, src)
+
+	facts := map[string]interface{}{"User.miles": 2000, "User.plan": "gold"}
+	activations, err := rs.Evaluate(facts)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"DISCOUNT_10", "DISCOUNT_5"}, activationThens(activations))
+
+	_, err = rs.Swap(next)
+	assert.Nil(t, err)
+	activations, err = rs.Evaluate(facts)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"DISCOUNT_5"}, activationThens(activations))
+}
+
+func Test_ruleset_swapWhileEvaluating(t *testing.T) {
+	rs := newTestRuleset()
+	miles := NewNumber("User", "miles", 0)
+	ctx := newTestContext(t, rs, emptyStr, miles)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := int64(0); i < 200; i++ {
+			assert.Nil(t, ctx.SetNumber(miles, i))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := int64(0); i < 50; i++ {
+			next := rs.NewVersion()
+			c := Builder().NumberCondition().Term("User", "miles").GreaterThan(i).Build()
+			r, _ := Builder().Rule().AllOf(c).Then("apply").Build()
+			assert.Nil(t, next.AddRule(r))
+			_, err := rs.Swap(next)
+			assert.Nil(t, err)
+		}
+	}()
+	wg.Wait()
+	assert.EqualValues(t, 51, rs.Version())
+}
+
+func Test_ruleset_evaluate(t *testing.T) {
+	var called bool
+	rs := Builder().Ruleset().OnActivation(func(string, Context) { called = true }).OnError(func(error) {}).Build()
+	addTestRules(t, rs, `
+		rule "frequent flyer" when all { User.plan == "gold"; User.miles > 3000 } then "ACTIVE_GOLD_AWARD"
+		rule "long trip" when any { number Trip.miles > User.miles } then "LONG_TRIP"
+	`)
+
+	activations, err := rs.Evaluate(map[string]interface{}{"User.plan": "gold", "User.miles": 3500, "Trip.miles": int64(4000)})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []Activation{
+		{
+			Rule:       "frequent flyer",
+			Name:       "frequent flyer",
+			Then:       "ACTIVE_GOLD_AWARD",
+			Conditions: []string{"User.plan_==_gold", "User.miles_>_3000"},
+			Matched:    2,
+			Facts:      map[string]interface{}{"User.plan": "gold", "User.miles": int64(3500)},
+			Version:    1,
+		},
+		{
+			Rule:       "long trip",
+			Name:       "long trip",
+			Then:       "LONG_TRIP",
+			Conditions: []string{"Trip.miles_>_User.miles"},
+			Matched:    1,
+			Facts:      map[string]interface{}{"Trip.miles": int64(4000), "User.miles": int64(3500)},
+			Version:    1,
+		},
+	}, activations)
+
+	activations, err = rs.Evaluate(map[string]interface{}{"User.plan": "silver", "User.miles": 3500})
+	assert.Nil(t, err)
+	assert.Len(t, activations, 0)
+
+	assert.False(t, called)
+	assert.Nil(t, rs.current().idx.Get("/User/plan/gold"))
+	assert.Nil(t, rs.current().idx.Get("/User/miles/3500"))
+
+	_, err = rs.Evaluate(map[string]interface{}{"User": "gold"})
+	assert.ErrorIs(t, err, ErrMalformedFact)
+
+	_, err = rs.Evaluate(map[string]interface{}{"User.plan": []int{1}})
+	assert.ErrorIs(t, err, ErrInvalidValueType)
+}
+
+func Test_ruleset_evaluateFromHandlers(t *testing.T) {
+	var rs *ruleset
+	now := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+	evaluated := make([]string, 0)
+	evaluate := func(from string) {
+		activations, err := rs.Evaluate(map[string]interface{}{"User.plan": "gold"})
+		assert.Nil(t, err)
+		if len(activations) > 0 {
+			evaluated = append(evaluated, from)
+		}
+	}
+	rs = Builder().Ruleset().
+		Clock(func() time.Time { return now }).
+		OnLifecycle(func(RuleLifecycle) { evaluate("lifecycle") }).
+		OnActivation(func(string, Context) { evaluate("activation") }).
+		OnError(func(error) {}).
+		Build()
+
+	c := Builder().StringCondition().Term("User", "plan").Equal("gold").Build()
+	r, err := Builder().Rule().Id("black friday").
+		EffectiveFrom(time.Date(2022, 11, 24, 0, 0, 0, 0, time.UTC)).
+		AllOf(c).Then("DISCOUNT").Build()
+	assert.Nil(t, err)
+	assert.Nil(t, rs.AddRule(r))
+
+	now = time.Date(2022, 11, 25, 0, 0, 0, 0, time.UTC)
+	ctx := newTestContext(t, rs, emptyStr, NewString("User", "plan", "gold"))
+	done := make(chan error)
+	go func() { done <- ctx.Update(func(tx *Tx) {}) }()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		assert.FailNow(t, "the one-shot evaluation deadlocked")
+	}
+	assert.EqualValues(t, []string{"lifecycle", "activation"}, evaluated)
+}
@@ -0,0 +1,68 @@
+package goldfish_re
+
+import "fmt"
+
+// _schema declared data type of each fact keyed by its token (Object.attribute).
+// A nil schema accepts any fact.
+type _schema map[string]tTerm
+
+// kind returns the declared data type of the given fact token
+func (s _schema) kind(token string) (tTerm, bool) {
+	k, ok := s[token]
+	return k, ok
+}
+
+// checkTerm validates that a variable term kind matches the declared fact data type
+func (s _schema) checkTerm(t iTerm) error {
+	if !t.isVariable() {
+		return nil
+	}
+
+	if k, ok := s.kind(t.token()); ok && k != t.termKind() {
+		return fmt.Errorf("%w: %s is declared as %s but used as %s", ErrSchemaMismatch, t.token(), k, t.termKind())
+	}
+	return nil
+}
+
+// checkCondition validates the condition terms against the schema and between them
+func (s _schema) checkCondition(c *_condition) error {
+	if err := s.checkTerm(c.lTerm); err != nil {
+		return fmt.Errorf("condition %q: %w", c.token(), err)
+	}
+
+	if err := s.checkTerm(c.rTerm); err != nil {
+		return fmt.Errorf("condition %q: %w", c.token(), err)
+	}
+
+	if c.lTerm.termKind() != c.rTerm.termKind() {
+		return fmt.Errorf("condition %q: %w: %s and %s", c.token(), ErrIncompatibleTerms, c.lTerm.termKind(), c.rTerm.termKind())
+	}
+
+	return nil
+}
+
+// checkRule validates each one of the rule conditions
+func (s _schema) checkRule(r *_rule) error {
+	for _, c := range r.sortedConditions() {
+		if err := s.checkCondition(c); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range r.actions {
+		if k, ok := s.kind(a.fact); ok {
+			if err := a.check(k); err != nil {
+				return fmt.Errorf("action %q: %w", a, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkFact validates that the fact value matches its declared data type
+func (s _schema) checkFact(f iFact) error {
+	if k, ok := s.kind(f.token()); ok && k != termType(f.value()) {
+		return fmt.Errorf("%w: %s is declared as %s but registered as %s", ErrSchemaMismatch, f.token(), k, termType(f.value()))
+	}
+	return nil
+}
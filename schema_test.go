@@ -0,0 +1,55 @@
+package goldfish_re
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_schema_checkRule(t *testing.T) {
+	schema := Builder().Schema().String("User", "plan").Number("User", "miles").Build()
+	rs := Builder().Ruleset().Schema(schema).OnActivation(func(string, Context) {}).OnError(func(error) {}).Build()
+
+	c1 := Builder().StringCondition().Term("User", "plan").Equal("gold").Build()
+	c2 := Builder().NumberCondition().Term("User", "miles").GreaterThan(3000).Build()
+	r, _ := Builder().Rule().AllOf(c1, c2).Then("GOLD").Build()
+	assert.Nil(t, rs.AddRule(r))
+
+	c3 := Builder().NumberCondition().Term("User", "plan").Equal(1).Build()
+	r, _ = Builder().Rule().AllOf(c3).Then("PLAN").Build()
+	assert.ErrorIs(t, rs.AddRule(r), ErrSchemaMismatch)
+
+	c4 := Builder().NumberCondition().Term("Trip", "miles").GreaterThanTerm("User", "miles").Build()
+	r, _ = Builder().Rule().AllOf(c4).Then("TRIP").Build()
+	assert.Nil(t, rs.AddRule(r))
+
+	c5 := Builder().StringCondition().Term("Trip", "class").EqualTerm("User", "miles").Build()
+	r, _ = Builder().Rule().AllOf(c5).Then("CLASS").Build()
+	assert.ErrorIs(t, rs.AddRule(r), ErrSchemaMismatch)
+
+	// cross fact comparisons are checked even without schema
+	c6 := newConditionBuilder().Left(newStringVarTerm("Trip", "class")).Right(newNumberVarTerm("Trip", "miles")).Operation(opEquals).Build()
+	r, _ = Builder().Rule().AllOf(c6).Then("MIXED").Build()
+	assert.ErrorIs(t, newTestRuleset().AddRule(r), ErrIncompatibleTerms)
+
+	assert.EqualValues(t, 2, rs.current().lenr())
+}
+
+func Test_schema_checkFact(t *testing.T) {
+	schema := Builder().Schema().String("User", "plan").Number("User", "miles").Build()
+	rs := Builder().Ruleset().Schema(schema).OnActivation(func(string, Context) {}).OnError(func(error) {}).Build()
+	ctx := rs.Context()
+
+	usr := &struct{}{}
+	assert.Nil(t, ctx.RegisterString(usr, NewString("User", "plan", "gold")))
+	assert.ErrorIs(t, ctx.RegisterString(usr, NewString("User", "miles", "many")), ErrSchemaMismatch)
+
+	type User struct {
+		Plan  Number
+		Miles Number
+	}
+	assert.ErrorIs(t, ctx.Register(&User{}), ErrSchemaMismatch)
+
+	_, err := rs.Evaluate(map[string]interface{}{"User.plan": 10})
+	assert.ErrorIs(t, err, ErrSchemaMismatch)
+}
@@ -16,12 +16,31 @@ const (
 	termDate
 )
 
+func (t tTerm) String() string {
+	switch t {
+	case termString:
+		return "string"
+	case termNumber:
+		return "number"
+	case termFloat:
+		return "float"
+	case termBoolean:
+		return "boolean"
+	case termDate:
+		return "date"
+	default:
+		return undefined
+	}
+}
+
 type iTerm interface {
 	token() string
 	path() string
 	object() string
 	attribute() string
 	val() interface{}
+	termKind() tTerm
+	isVariable() bool
 }
 
 type _term struct {
@@ -76,6 +95,24 @@ func newVarTerm(object, attribute string, kind tTerm) *_term {
 	return newTerm(true, object, attribute, nil, kind)
 }
 
+// newTypedVarTerm returns a var term of the given kind initialized with its zero value
+func newTypedVarTerm(object, attribute string, kind tTerm) *_term {
+	switch kind {
+	case termString:
+		return newStringVarTerm(object, attribute)
+	case termNumber:
+		return newNumberVarTerm(object, attribute)
+	case termFloat:
+		return newFloatVarTerm(object, attribute)
+	case termBoolean:
+		return newBooleanVarTerm(object, attribute)
+	case termDate:
+		return newDateVarTerm(object, attribute)
+	default:
+		return newVarTerm(object, attribute, kind)
+	}
+}
+
 // --- Number
 
 func newNumberVarTermWithValue(object, attribute string, value int64) *_term {
@@ -145,3 +182,5 @@ func (t *_term) path() string {
 func (t *_term) object() string    { return t.object_ }
 func (t *_term) attribute() string { return t.attribute_ }
 func (t *_term) val() interface{}  { return t.value }
+func (t *_term) termKind() tTerm   { return t.kind }
+func (t *_term) isVariable() bool  { return t.isVar }
@@ -0,0 +1,60 @@
+package goldfish_re
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_tx_reads(t *testing.T) {
+	date := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+	plan, miles, ratio := NewString("User", "plan", "gold"), NewNumber("User", "miles", 100), NewFloat("User", "ratio", 1.5)
+	active, birthday := NewBoolean("User", "active", true), NewDate("User", "birthday", date)
+
+	tx := newTx()
+	assert.EqualValues(t, "gold", tx.GetString(plan))
+	assert.EqualValues(t, 100, tx.GetNumber(miles))
+	assert.EqualValues(t, 1.5, tx.GetFloat(ratio))
+	assert.True(t, tx.GetBoolean(active))
+	assert.EqualValues(t, date, tx.GetDate(birthday))
+
+	tx.SetNumber(miles, 200)
+	tx.IncrementNumber(miles, 2580)
+	tx.IncrementFloat(ratio, 0.5)
+	tx.AppendString(plan, "+")
+	tx.SetBoolean(active, false)
+	assert.EqualValues(t, 2780, tx.GetNumber(miles))
+	assert.EqualValues(t, 2.0, tx.GetFloat(ratio))
+	assert.EqualValues(t, "gold+", tx.GetString(plan))
+	assert.False(t, tx.GetBoolean(active))
+	assert.EqualValues(t, 100, miles.Value())
+
+	tx.commit()
+	assert.Nil(t, tx.err)
+	assert.EqualValues(t, 2780, miles.Value())
+}
+
+func Test_tx_concurrentIncrements(t *testing.T) {
+	miles := NewNumber("User", "miles", 0)
+	ctx := newTestContext(t, newTestRuleset(), emptyStr, miles)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, ctx.Update(func(tx *Tx) { tx.IncrementNumber(miles, 2) }))
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 100, miles.Value())
+
+	// coalesced increments read the values staged by the batch
+	assert.Nil(t, ctx.WithCoalescing(0, 5))
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, ctx.Update(func(tx *Tx) { tx.IncrementNumber(miles, 1) }))
+	}
+	assert.EqualValues(t, 105, miles.Value())
+}
@@ -22,6 +22,15 @@ func objectName(fact string) string {
 	return fact
 }
 
+// splitToken splits a fact token like User.plan into its object and attribute
+func splitToken(token string) (object, attribute string, ok bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || parts[0] == emptyStr || parts[1] == emptyStr {
+		return emptyStr, emptyStr, false
+	}
+	return parts[0], parts[1], true
+}
+
 func conditionToken(left, right, operator string, negated bool) string {
 	if negated {
 		return fmt.Sprintf("!%s_%s_%s", left, operator, right)
@@ -29,6 +38,14 @@ func conditionToken(left, right, operator string, negated bool) string {
 	return fmt.Sprintf("%s_%s_%s", left, operator, right)
 }
 
+func ruleToken(conditions []string, operator, then string) string {
+	return fmt.Sprintf("%s=>%s", groupToken(conditions, operator), then)
+}
+
+func groupToken(expressions []string, operator string) string {
+	return fmt.Sprintf("%s(%s)", operator, strings.Join(expressions, ","))
+}
+
 func growthSlice[T interface{}](s []T, size int) []T {
 	return append(s, make([]T, size)...)
 }
@@ -50,10 +67,41 @@ func termType(v interface{}) tTerm {
 	}
 }
 
+// factValue converts a Go value into one of the supported fact data types
+func factValue(v interface{}) (interface{}, bool) {
+	switch val := v.(type) {
+	case string, int64, float64, bool, time.Time:
+		return val, true
+	case int:
+		return int64(val), true
+	case int8:
+		return int64(val), true
+	case int16:
+		return int64(val), true
+	case int32:
+		return int64(val), true
+	case uint8:
+		return int64(val), true
+	case uint16:
+		return int64(val), true
+	case uint32:
+		return int64(val), true
+	case float32:
+		return float64(val), true
+	default:
+		return nil, false
+	}
+}
+
 func indexPath(object, attribute string, value interface{}) string {
 	return fmt.Sprintf("/%s/%s/%v", object, attribute, value)
 }
 
+// indexPathPrefix index path shared by all values of the given fact
+func indexPathPrefix(object, attribute string) string {
+	return fmt.Sprintf("/%s/%s/", object, attribute)
+}
+
 func indexPathFact(fact iFact) string {
 	return indexPath(fact.object(), fact.attribute(), fact.value())
 }
@@ -80,6 +128,15 @@ func parseDateOrDefault(s string, def time.Time) time.Time {
 	return def
 }
 
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return zeroDate, ErrInvalidValueType
+}
+
 func parseFloatOrDefault(s string, def float64) float64 {
 	if n, err := strconv.ParseFloat(s, 64); err == nil {
 		return n
@@ -98,3 +155,14 @@ func CalendarDateUTC(y, m, d int) time.Time {
 func CalendarFullDateUTC(y, m, d, h, mm, s, ns int) time.Time {
 	return time.Date(y, time.Month(m), d, h, m, s, ns, time.UTC)
 }
+
+// union returns a new set with the values of the given sets
+func union(sets ...map[string]struct{}) map[string]struct{} {
+	u := map[string]struct{}{}
+	for _, set := range sets {
+		for k := range set {
+			u[k] = struct{}{}
+		}
+	}
+	return u
+}